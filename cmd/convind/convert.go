@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/datasync"
+)
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind convert <src-store> <dst-store>\n")
+		fmt.Fprintf(fs.Output(), "Copies all revisions and traits from one data store to another, e.g. from a directory to bolt:<path>.\n")
+		fmt.Fprintf(fs.Output(), "Nothing is copied back, and src is left as-is. Trashed data and data without revisions are not copied.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two stores")
+	}
+	src, err := data.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer data.Close(src)
+	dst, err := data.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer data.Close(dst)
+	trash, err := src.Trash()
+	if err != nil {
+		return err
+	}
+	if len(trash) > 0 {
+		fmt.Printf("skipping %d trashed data\n", len(trash))
+	}
+	stats, err := datasync.Copy(datasync.StorePeer(src), datasync.StorePeer(dst))
+	fmt.Printf("copied %d revision(s) and %d trait(s)\n", stats.AToB, stats.TraitsAToB)
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func runFsck(args []string) error {
+	var opts data.CheckOptions
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fs.BoolVar(&opts.Repair, "repair", false, "repair problems that can be fixed without losing data")
+	fs.BoolVar(&opts.Quarantine, "quarantine", false, "move entries with problems that cannot be repaired into the .quarantine directory of the store")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind fsck [-repair] [-quarantine] <store>\n")
+		fmt.Fprintf(fs.Output(), "Checks the consistency of a data store directory.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a store")
+	}
+	store, err := data.OpenFSDataStore(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	problems, err := store.Check(opts)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		return err
+	}
+	unresolved := 0
+	for _, p := range problems {
+		if !p.Resolved {
+			unresolved++
+		}
+	}
+	if unresolved > 0 {
+		return fmt.Errorf("%d problem(s) found", unresolved)
+	}
+	return nil
+}
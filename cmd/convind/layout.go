@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	var sharded bool
+	fs.BoolVar(&sharded, "sharded", false, "put data in a directory per month, for stores with many data")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind init [-sharded] <dir>\n")
+		fmt.Fprintf(fs.Output(), "Creates an empty data store directory.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a directory")
+	}
+	layout := data.FSLayoutFlat
+	if sharded {
+		layout = data.FSLayoutSharded
+	}
+	_, err := data.InitFSDataStore(fs.Arg(0), layout)
+	return err
+}
+
+func runRelayout(args []string) error {
+	fs := flag.NewFlagSet("relayout", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind relayout flat|sharded <store>\n")
+		fmt.Fprintf(fs.Output(), "Moves all data of a data store directory into the given layout.\n")
+		fmt.Fprintf(fs.Output(), "Restart wiki-servers using the store afterwards, so that new data is created in the new layout.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a layout and a store")
+	}
+	store, err := data.OpenFSDataStore(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	moved, err := store.Relayout(data.FSLayout(fs.Arg(0)))
+	fmt.Printf("moved %d data\n", moved)
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of convind.
+// args does not include the subcommand name itself.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"sync":     {"sync <store-or-url> <store-or-url>", runSync},
+	"fsck":     {"fsck [-repair] [-quarantine] <store>", runFsck},
+	"migrate":  {"migrate <store>", runMigrate},
+	"convert":  {"convert <src-store> <dst-store>", runConvert},
+	"trash":    {"trash list|restore|purge <store> [<id>...]", runTrash},
+	"init":     {"init [-sharded] <dir>", runInit},
+	"relayout": {"relayout flat|sharded <store>", runRelayout},
+	"query":    {"query [-json] <store-or-url> <query>...", runQuery},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\tconvind %s\n", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind migrate <store>\n")
+		fmt.Fprintf(fs.Output(), "Fills in missing revision metadata (e.g. creation times from file modification times) of a data store directory.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a store")
+	}
+	store, err := data.OpenFSDataStore(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	migrated, err := store.MigrateMetadata()
+	fmt.Printf("migrated %d revision(s)\n", migrated)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/query"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	var jsonOutput bool
+	fs.BoolVar(&jsonOutput, "json", false, "print each result as JSON (one per line) instead of its ID, MIME type and title")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind query [-json] <store-or-url> <query>...\n")
+		fmt.Fprintf(fs.Output(), "Lists data matching the query (e.g. 'mime:image/* instance:tesseract=invoice'), newest first; see the query package for the syntax.\n")
+		fmt.Fprintf(fs.Output(), "Against a wiki-server URL, instances of all classes of the server can be queried; against a data store, only the wiki class is available.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("expected a store")
+	}
+	q := strings.Join(fs.Args()[1:], " ")
+	output := func(raw json.RawMessage) error {
+		if jsonOutput {
+			_, err := fmt.Printf("%s\n", raw)
+			return err
+		}
+		var entry wiki.IndexEntry
+		err := json.Unmarshal(raw, &entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\t%s\t%s\n", entry.ID, entry.MIMEType, entry.Title)
+		return err
+	}
+	if strings.HasPrefix(fs.Arg(0), "http://") || strings.HasPrefix(fs.Arg(0), "https://") {
+		return queryURL(fs.Arg(0), q, output)
+	}
+	return queryStore(fs.Arg(0), q, output)
+}
+
+// queryStore runs q against the data store at path, with an index built by reading the whole store.
+func queryStore(path, q string, output func(json.RawMessage) error) error {
+	parsed, err := query.Parse(q)
+	if err != nil {
+		return err
+	}
+	store, err := data.Open(path)
+	if err != nil {
+		return err
+	}
+	defer data.Close(store)
+	index, err := wiki.OpenIndex(store, "")
+	if err != nil {
+		return err
+	}
+	src := query.Source{Store: store, Index: index, Classes: []data.Class{wiki.NewWikiClass(index)}}
+	return parsed.Run(context.Background(), src, func(entry wiki.IndexEntry) error {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return output(raw)
+	})
+}
+
+// queryURL runs q on the wiki-server at baseURL.
+func queryURL(baseURL, q string, output func(json.RawMessage) error) error {
+	resp, err := http.Get(strings.TrimSuffix(baseURL, "/") + "/api/v1/query?q=" + url.QueryEscape(q))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Code, Message string }
+		raw, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(raw, &e) == nil && e.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, raw)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var e struct{ Code, Message string }
+		if json.Unmarshal(raw, &e) == nil && e.Code != "" {
+			// the server failed after sending some results
+			return fmt.Errorf("%s: %s", e.Code, e.Message)
+		}
+		err = output(raw)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/datasync"
+)
+
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind sync <store-or-url> <store-or-url>\n")
+		fmt.Fprintf(fs.Output(), "Copies revisions and traits missing on either side, so both end up with all revisions.\n")
+		fmt.Fprintf(fs.Output(), "Each side is either a data store (a directory, or bolt:<path> for a single-file database) or the URL of a wiki-server (e.g. http://127.0.0.1:8080).\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two stores")
+	}
+	a, closeA, err := openPeer(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeA()
+	b, closeB, err := openPeer(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer closeB()
+	stats, err := datasync.Sync(a, b)
+	fmt.Printf("copied %d revision(s) and %d trait(s) to %s\n", stats.AToB, stats.TraitsAToB, fs.Arg(1))
+	fmt.Printf("copied %d revision(s) and %d trait(s) to %s\n", stats.BToA, stats.TraitsBToA, fs.Arg(0))
+	if stats.SkippedAToB > 0 || stats.SkippedBToA > 0 {
+		fmt.Printf("skipped %d revision(s) of data in the trash of %s, and %d of data in the trash of %s; restore the data to sync them\n", stats.SkippedAToB, fs.Arg(1), stats.SkippedBToA, fs.Arg(0))
+	}
+	return err
+}
+
+// openPeer opens a wiki-server URL or a data store (see [data.Open]).
+// The returned function closes the peer.
+func openPeer(s string) (datasync.Peer, func(), error) {
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return datasync.HTTPPeer(s, http.DefaultClient), func() {}, nil
+	}
+	store, err := data.Open(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return datasync.StorePeer(store), func() { data.Close(store) }, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func runTrash(args []string) error {
+	fs := flag.NewFlagSet("trash", flag.ExitOnError)
+	var olderThan time.Duration
+	fs.DurationVar(&olderThan, "older-than", 0, "with purge and no IDs, only purge data trashed longer ago than this")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: convind trash list <store>\n")
+		fmt.Fprintf(fs.Output(), "       convind trash restore <store> <id>...\n")
+		fmt.Fprintf(fs.Output(), "       convind trash [-older-than duration] purge <store> [<id>...]\n")
+		fmt.Fprintf(fs.Output(), "Lists, restores or permanently deletes trashed data. Purge without IDs purges the whole trash.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected a subcommand and a store")
+	}
+	store, err := data.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer data.Close(store)
+	ids := make([]data.ID, fs.NArg()-2)
+	for i, raw := range fs.Args()[2:] {
+		ids[i], err = data.ParseID(raw)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", raw, err)
+		}
+	}
+	switch fs.Arg(0) {
+	case "list":
+		entries, err := store.Trash()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s\t%s\t%s\n", entry.ID, entry.DeletionTime.Format(time.RFC3339), entry.MIMEType)
+		}
+		return nil
+	case "restore":
+		for _, id := range ids {
+			err := store.RestoreByID(id)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", id, err)
+			}
+		}
+		return nil
+	case "purge":
+		if len(ids) == 0 {
+			purged, err := data.PurgeTrash(store, time.Now().Add(-olderThan))
+			fmt.Printf("purged %d data\n", purged)
+			return err
+		}
+		for _, id := range ids {
+			err := store.PurgeByID(id)
+			if err != nil {
+				return fmt.Errorf("purge %s: %w", id, err)
+			}
+		}
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown subcommand %s", fs.Arg(0))
+	}
+}
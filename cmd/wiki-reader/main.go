@@ -11,7 +11,7 @@ import (
 
 func main() {
 	var dataStorePath string
-	flag.StringVar(&dataStorePath, "data-store", "", "path to root of FS data store")
+	flag.StringVar(&dataStorePath, "data-store", "", "path to root of FS data store, bolt:<path> for a single-file database, or mem: for a throwaway in-memory store")
 	flag.Parse()
 	if flag.NArg() != 1 {
 		flag.Usage()
@@ -26,13 +26,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	dataStore := data.NewFSDataStoreFromSubdirectory(dataStorePath)
+	dataStore, err := data.Open(dataStorePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open data store: %s\n", err)
+		os.Exit(1)
+	}
+	defer data.Close(dataStore)
 	data, err := dataStore.GetDataByID(*id)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "get data: %s\n", err)
 		os.Exit(1)
 	}
-	page := wiki.Page{data}
+	page := wiki.Page{Data: data}
 	pr, err := page.LatestRevision()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "get latest revision: %s\n", err)
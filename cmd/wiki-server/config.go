@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/embedding"
+	"inaba.kiyuri.ca/2025/convind/search"
+	"inaba.kiyuri.ca/2025/convind/sometext"
+	"inaba.kiyuri.ca/2025/convind/wiki/server"
+)
+
+// defaultConfig is used when no -config is given.
+//
+//go:embed classes.json
+var defaultConfig []byte
+
+// loadConfig loads the config at path, or the default config if path is empty.
+func loadConfig(path string) (*sometext.Config, error) {
+	if path == "" {
+		return sometext.ParseConfig(bytes.NewReader(defaultConfig))
+	}
+	return sometext.LoadConfig(path)
+}
+
+// classes are the sometext classes of the server, and where they are used.
+type classes struct {
+	s              *server.Server
+	storeInTraits  bool
+	searchIndex    *search.Index
+	embeddingClass *embedding.Class
+	// current are the classes added to s.
+	current []data.Class
+}
+
+// apply replaces the current classes with the classes of config.
+func (c *classes) apply(config *sometext.Config) {
+	all, searchable := config.NewClasses()
+	added := make([]data.Class, len(all))
+	for i, class := range all {
+		class.SetStoreInTraits(c.storeInTraits)
+		added[i] = class
+	}
+	searchClasses := make([]data.Class, len(searchable))
+	for i, class := range searchable {
+		searchClasses[i] = class
+	}
+	c.s.ReplaceClasses(c.current, added)
+	c.current = added
+	if c.searchIndex != nil {
+		c.searchIndex.SetClasses(searchClasses)
+	}
+	if c.embeddingClass != nil {
+		c.embeddingClass.SetTextClasses(searchClasses)
+	}
+}
+
+// reloadOnSIGHUP reloads the config at path and applies it to c on each SIGHUP.
+// If the config is invalid, the error is logged and the current classes are kept.
+func reloadOnSIGHUP(path string, c *classes) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		config, err := loadConfig(path)
+		if err != nil {
+			log.Printf("reload config: %s; keeping the current classes", err)
+			continue
+		}
+		c.apply(config)
+		log.Printf("reloaded config: %d classes", len(c.current))
+	}
+}
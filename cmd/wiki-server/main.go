@@ -1,39 +1,124 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"inaba.kiyuri.ca/2025/convind/data"
-	"inaba.kiyuri.ca/2025/convind/sometext"
+	"inaba.kiyuri.ca/2025/convind/embedding"
+	"inaba.kiyuri.ca/2025/convind/search"
+	"inaba.kiyuri.ca/2025/convind/wiki"
 	"inaba.kiyuri.ca/2025/convind/wiki/server"
 )
 
 func main() {
 	var bind string
 	var dataStorePath string
+	var storeInTraits bool
+	var trashPurgeAge time.Duration
+	var indexPath string
+	var reindex bool
+	var searchIndexPath string
+	var embeddingCommand string
+	var configPath string
 	flag.StringVar(&bind, "bind", "127.0.0.1:8080", "server binds to this address")
-	flag.StringVar(&dataStorePath, "data-store", "", "path to root of FS data store")
+	flag.StringVar(&dataStorePath, "data-store", "", "path to root of FS data store, bolt:<path> for a single-file database, or mem: for a throwaway in-memory store")
+	flag.BoolVar(&storeInTraits, "store-outputs-in-traits", false, "store outputs of commands as traits in the data store instead of in a temporary directory")
+	flag.DurationVar(&trashPurgeAge, "trash-purge-age", 0, "permanently delete data that has been in the trash for longer than this, e.g. 720h (0 to keep forever)")
+	flag.StringVar(&indexPath, "index", "", "path to the index database, kept across restarts (empty to keep the index in memory)")
+	flag.BoolVar(&reindex, "reindex", false, "rebuild the index (and the search index) from scratch on startup")
+	flag.StringVar(&searchIndexPath, "search-index", "", "path to the full-text search index database, kept across restarts so that e.g. OCR doesn't run again (empty to keep the search index in memory)")
+	flag.StringVar(&embeddingCommand, "embedding-command", "", "command (split on spaces) that reads text on stdin and prints its embedding vector, for finding similar data (empty to disable)")
+	flag.StringVar(&configPath, "config", "", "path to a JSON file configuring classes that run commands (see sometext.Config; empty for the built-in classes.json); reloaded on SIGHUP")
 	flag.Parse()
 
-	dataStore := data.NewFSDataStoreFromSubdirectory(dataStorePath)
-	s, err := server.New(dataStore)
+	// checked before anything else, so that mistakes are reported right away
+	config, err := loadConfig(configPath)
 	if err != nil {
-		panic(err)
-	}
-	s.AddClass(sometext.NewSometextClass("inaba.kiyuri.ca/2025/convind/cmd/wiki-server/wc", []sometext.HandlerFunc{
-		sometext.MakePrefixHandler("text/", []string{"wc"}),
-	}, "text/plain"))
-	s.AddClass(sometext.NewSometextClass("inaba.kiyuri.ca/2025/convind/cmd/wiki-server/file", []sometext.HandlerFunc{
-		sometext.MakePrefixHandler("", []string{"file", "-"}),
-	}, "text/plain"))
-	s.AddClass(sometext.NewSometextClass("inaba.kiyuri.ca/2025/convind/cmd/wiki-server/tesseract", []sometext.HandlerFunc{
-		sometext.MakePrefixHandler("image/", []string{"tesseract", "-l", "jpn+eng", "-", "-"}),
-	}, "text/plain"))
-	s.AddClass(sometext.NewSometextClass("inaba.kiyuri.ca/2025/convind/cmd/wiki-server/thumb", []sometext.HandlerFunc{
-		sometext.MakePrefixHandler("image/", []string{"convert", "-", "-thumbnail", "256x256", "-"}),
-	}, "PASSTHROUGH"))
+		log.Fatalf("load config: %s", err)
+	}
+	embeddingArgs := strings.Fields(embeddingCommand)
+	if embeddingCommand != "" && len(embeddingArgs) == 0 {
+		log.Fatalf("-embedding-command: no command")
+	}
+	dataStore, err := data.Open(dataStorePath)
+	if err != nil {
+		log.Fatalf("open data store: %s", err)
+	}
+	index, err := wiki.OpenIndex(dataStore, indexPath)
+	if err != nil {
+		log.Fatalf("open index: %s", err)
+	}
+	defer index.Close()
+	if reindex && indexPath != "" {
+		err = index.Rebuild()
+		if err != nil {
+			log.Fatalf("rebuild index: %s", err)
+		}
+	}
+	s := server.NewWithIndex(index)
+	go func() {
+		// picks up changes by other processes (e.g. convind sync to the data store directory)
+		err := index.Follow(context.Background())
+		log.Printf("index: stopped following changes: %s", err)
+	}()
+	// search and embedding classes are set by the config
+	searchIndex, err := search.Open(dataStore, searchIndexPath, nil)
+	if err != nil {
+		log.Fatalf("open search index: %s", err)
+	}
+	defer searchIndex.Close()
+	s.SetSearchIndex(searchIndex)
+	var embeddingIndex *embedding.Index
+	if embeddingCommand != "" {
+		// the model is not part of the name, so use a new name (or delete the traits) when changing models
+		class := embedding.NewClass("inaba.kiyuri.ca/2025/convind/cmd/wiki-server/embedding", embeddingArgs, nil)
+		embeddingIndex = embedding.NewIndex(dataStore, class)
+		s.SetEmbeddingIndex(embeddingIndex)
+	}
+	c := &classes{s: s, storeInTraits: storeInTraits, searchIndex: searchIndex}
+	if embeddingIndex != nil {
+		c.embeddingClass = embeddingIndex.Class()
+	}
+	c.apply(config)
+	go reloadOnSIGHUP(configPath, c)
+
+	go func() {
+		if reindex {
+			err := searchIndex.Rebuild(context.Background())
+			if err != nil {
+				log.Printf("search: rebuild: %s", err)
+			}
+		}
+		err := searchIndex.Follow(context.Background())
+		log.Printf("search: stopped following changes: %s", err)
+	}()
+	if embeddingIndex != nil {
+		go func() {
+			err := embeddingIndex.Follow(context.Background())
+			log.Printf("embedding: stopped following changes: %s", err)
+		}()
+	}
+	if trashPurgeAge > 0 {
+		go purgeTrash(index.Store(), trashPurgeAge)
+	}
 	log.Printf("listening on %s…", bind)
 	log.Fatal(http.ListenAndServe(bind, s))
 }
+
+// purgeTrash periodically purges data that has been in the trash for longer than maxAge.
+func purgeTrash(dataStore data.DataStore, maxAge time.Duration) {
+	for {
+		n, err := data.PurgeTrash(dataStore, time.Now().Add(-maxAge))
+		if err != nil {
+			log.Printf("purging trash: %s", err)
+		} else if n > 0 {
+			log.Printf("purged %d data from trash", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
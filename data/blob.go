@@ -0,0 +1,107 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrHashMismatch is returned when reading a revision whose contents do not match its recorded content hash (i.e. the revision is corrupted).
+var ErrHashMismatch = errors.New("content hash mismatch")
+
+// blobPath returns the path of the blob with the given SHA-256 hash (in hex).
+// Blobs are content-addressed, so identical revisions (even of different data) share the same blob.
+func blobPath(prefix, sha256Hex string) string {
+	return filepath.Join(prefix, ".blobs", sha256Hex[:2], sha256Hex)
+}
+
+// writeBlob stores the contents of r as a blob, and returns its SHA-256 hash (in hex).
+// If an identical blob already exists, it is reused.
+// The blob is only visible (under its final path) once it is completely written and synced to disk.
+func writeBlob(prefix string, r io.Reader) (string, error) {
+	dir := filepath.Join(prefix, ".blobs")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	sha256Hex := hex.EncodeToString(h.Sum(nil))
+	path := blobPath(prefix, sha256Hex)
+	_, err = os.Stat(path)
+	if err == nil {
+		// deduplicated
+		return sha256Hex, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex, syncDir(filepath.Dir(path))
+}
+
+// verifyingReadCloser returns [ErrHashMismatch] at EOF if the contents read do not match the expected SHA-256 hash.
+type verifyingReadCloser struct {
+	rc        io.ReadCloser
+	h         hash.Hash
+	sha256Hex string
+}
+
+func newVerifyingReadCloser(rc io.ReadCloser, sha256Hex string) *verifyingReadCloser {
+	return &verifyingReadCloser{rc, sha256.New(), sha256Hex}
+}
+
+func (v *verifyingReadCloser) Read(p []byte) (int, error) {
+	n, err := v.rc.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		got := hex.EncodeToString(v.h.Sum(nil))
+		if got != v.sha256Hex {
+			return n, fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, v.sha256Hex, got)
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReadCloser) Close() error {
+	return v.rc.Close()
+}
+
+// hashReader returns the SHA-256 hash (in hex) of the contents of r.
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,641 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDataStore is a [DataStore] keeping all data in a single bbolt database file, which is friendlier to slow storage (e.g. SD cards) and backups than [FSDataStore].
+//
+// The database has a top-level bucket "data" with a bucket per data (keyed by ID), which contains:
+//   - "mimeType": the MIME type
+//   - "deleted": the deletion time (RFC 3339) if the data is in the trash
+//   - "revisions": revision metadata (as in [FSDataStore]) keyed by big-endian revision ID
+//   - "contents": revision contents keyed by big-endian revision ID
+//   - "traits": a bucket per revision (keyed by big-endian revision ID) of trait contents keyed by name
+//
+// and a top-level bucket "changes" with the change log (see [ChangeLog]), of [Event]s as JSON keyed by big-endian sequence number.
+//
+// Only one process can open the database at a time.
+type BoltDataStore struct {
+	db       *bolt.DB
+	watchers watchers
+}
+
+var (
+	_ DataStoreContext = (*BoltDataStore)(nil)
+	_ Watcher          = (*BoltDataStore)(nil)
+	_ ChangeLog        = (*BoltDataStore)(nil)
+)
+
+var (
+	boltDataBucket      = []byte("data")
+	boltMIMETypeKey     = []byte("mimeType")
+	boltDeletedKey      = []byte("deleted")
+	boltRevisionsBucket = []byte("revisions")
+	boltContentsBucket  = []byte("contents")
+	boltTraitsBucket    = []byte("traits")
+	boltChangesBucket   = []byte("changes")
+)
+
+// OpenBoltDataStore opens (or creates) the database at path.
+// If another process has the database open, an error is returned after a second.
+func OpenBoltDataStore(path string) (*BoltDataStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltDataBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(boltChangesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltDataStore{db: db}, nil
+}
+
+// Close closes the database.
+func (b *BoltDataStore) Close() error {
+	return b.db.Close()
+}
+
+func revisionKey(revisionID uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, revisionID)
+}
+
+// dataBucket returns the bucket of the given data, and nil if there is no such data.
+// Trashed data is only returned if trashed is true.
+func dataBucket(tx *bolt.Tx, id ID, trashed bool) *bolt.Bucket {
+	bucket := tx.Bucket(boltDataBucket).Bucket([]byte(id.String()))
+	if bucket == nil || (bucket.Get(boltDeletedKey) != nil) != trashed {
+		return nil
+	}
+	return bucket
+}
+
+func (b *BoltDataStore) GetDataByID(id ID) (Data, error) {
+	var d *BoltData
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := dataBucket(tx, id, false)
+		if bucket == nil {
+			return notExist(id)
+		}
+		d = &BoltData{store: b, id: id, mimeType: string(bucket.Get(boltMIMETypeKey))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (b *BoltDataStore) New(mimeType string) (Data, error) {
+	return b.createData(GenerateRandomID(), mimeType)
+}
+
+func (b *BoltDataStore) createData(id ID, mimeType string) (*BoltData, error) {
+	if mimeType == "" {
+		mimeType = DefaultMIMEType
+	}
+	e := Event{Kind: EventNew, ID: id, MIMEType: mimeType}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		_, err := createDataBucket(tx, id, mimeType)
+		if err != nil {
+			return err
+		}
+		return logChanges(tx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.watchers.emit(e)
+	return &BoltData{store: b, id: id, mimeType: mimeType}, nil
+}
+
+func createDataBucket(tx *bolt.Tx, id ID, mimeType string) (*bolt.Bucket, error) {
+	bucket, err := tx.Bucket(boltDataBucket).CreateBucket([]byte(id.String()))
+	if errors.Is(err, bolt.ErrBucketExists) {
+		return nil, fmt.Errorf("data %s: %w", id, ErrExists)
+	} else if err != nil {
+		return nil, err
+	}
+	err = bucket.Put(boltMIMETypeKey, []byte(mimeType))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range [][]byte{boltRevisionsBucket, boltContentsBucket, boltTraitsBucket} {
+		_, err = bucket.CreateBucket(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
+
+func (b *BoltDataStore) AllIDs() ([]ID, error) {
+	return b.AllIDsContext(context.Background())
+}
+
+// AllIDsContext is [BoltDataStore.AllIDs], but stops when ctx is done.
+func (b *BoltDataStore) AllIDsContext(ctx context.Context) ([]ID, error) {
+	ids := make([]ID, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDataBucket).ForEachBucket(func(k []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			id, err := ParseID(string(k))
+			if err != nil {
+				return err
+			}
+			if dataBucket(tx, id, false) != nil {
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+func (b *BoltDataStore) DeleteByID(id ID) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := dataBucket(tx, id, false)
+		if bucket == nil {
+			return notExist(id)
+		}
+		err := bucket.Put(boltDeletedKey, []byte(time.Now().Format(time.RFC3339Nano)))
+		if err != nil {
+			return err
+		}
+		return logChanges(tx, Event{Kind: EventDelete, ID: id})
+	})
+	if err != nil {
+		return err
+	}
+	b.watchers.emit(Event{Kind: EventDelete, ID: id})
+	return nil
+}
+
+func (b *BoltDataStore) Trash() ([]TrashEntry, error) {
+	entries := make([]TrashEntry, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDataBucket).ForEachBucket(func(k []byte) error {
+			id, err := ParseID(string(k))
+			if err != nil {
+				return err
+			}
+			bucket := dataBucket(tx, id, true)
+			if bucket == nil {
+				return nil
+			}
+			deletionTime, err := time.Parse(time.RFC3339Nano, string(bucket.Get(boltDeletedKey)))
+			if err != nil {
+				return fmt.Errorf("parse deletion time of %s: %w", id, err)
+			}
+			entries = append(entries, TrashEntry{id, string(bucket.Get(boltMIMETypeKey)), deletionTime})
+			return nil
+		})
+	})
+	slices.SortFunc(entries, func(a, b TrashEntry) int {
+		return b.DeletionTime.Compare(a.DeletionTime)
+	})
+	return entries, err
+}
+
+func (b *BoltDataStore) RestoreByID(id ID) error {
+	var e Event
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := dataBucket(tx, id, true)
+		if bucket == nil {
+			return notExist(id)
+		}
+		e = Event{Kind: EventNew, ID: id, MIMEType: string(bucket.Get(boltMIMETypeKey))}
+		err := bucket.Delete(boltDeletedKey)
+		if err != nil {
+			return err
+		}
+		return logChanges(tx, e)
+	})
+	if err != nil {
+		return err
+	}
+	b.watchers.emit(e)
+	return nil
+}
+
+func (b *BoltDataStore) PurgeByID(id ID) error {
+	e := Event{Kind: EventPurge, ID: id}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if dataBucket(tx, id, true) == nil {
+			return notExist(id)
+		}
+		err := tx.Bucket(boltDataBucket).DeleteBucket([]byte(id.String()))
+		if err != nil {
+			return err
+		}
+		return logChanges(tx, e)
+	})
+	if err != nil {
+		return err
+	}
+	b.watchers.emit(e)
+	return nil
+}
+
+func (b *BoltDataStore) ImportRevision(info RevisionInfo, r io.Reader) (DataRevision, error) {
+	// read before starting the transaction, as only one write transaction can run at a time
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var dr *BoltRevision
+	var events []Event
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDataBucket).Bucket([]byte(info.ID.String()))
+		if bucket == nil {
+			mimeType := info.MIMEType
+			if mimeType == "" {
+				mimeType = DefaultMIMEType
+			}
+			bucket, err = createDataBucket(tx, info.ID, mimeType)
+			if err != nil {
+				return err
+			}
+			events = append(events, Event{Kind: EventNew, ID: info.ID, MIMEType: mimeType})
+		} else if bucket.Get(boltDeletedKey) != nil {
+			return fmt.Errorf("data %s: %w", info.ID, ErrTrashed)
+		}
+		d := &BoltData{store: b, id: info.ID, mimeType: string(bucket.Get(boltMIMETypeKey))}
+		raw := bucket.Bucket(boltRevisionsBucket).Get(revisionKey(info.RevisionID))
+		if raw != nil {
+			var meta revisionMeta
+			err := json.Unmarshal(raw, &meta)
+			if err != nil {
+				return err
+			}
+			dr = &BoltRevision{d, info.RevisionID, meta}
+			return nil
+		}
+		var revisionEvents []Event
+		dr, revisionEvents, err = d.putRevision(bucket, info.RevisionID, contents, revisionMeta{
+			CreationTime: info.CreationTime,
+			Author:       info.Author,
+			Parents:      info.Parents,
+			MIMEType:     info.MIMEType,
+		})
+		if err != nil {
+			return err
+		}
+		events = append(events, revisionEvents...)
+		return logChanges(tx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.watchers.emit(events...)
+	return dr, nil
+}
+
+// logChanges adds events to the change log.
+func logChanges(tx *bolt.Tx, events ...Event) error {
+	bucket := tx.Bucket(boltChangesBucket)
+	for _, e := range events {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(binary.BigEndian.AppendUint64(nil, seq), raw)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BoltDataStore) Seq() (uint64, error) {
+	var seq uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(boltChangesBucket).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+func (b *BoltDataStore) Changes(since uint64) ([]Change, error) {
+	changes := make([]Change, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltChangesBucket).Cursor()
+		for k, v := c.Seek(binary.BigEndian.AppendUint64(nil, since+1)); k != nil; k, v = c.Next() {
+			change := Change{Seq: binary.BigEndian.Uint64(k)}
+			err := json.Unmarshal(v, &change.Event)
+			if err != nil {
+				return fmt.Errorf("parse change %d: %w", change.Seq, err)
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Watch returns a channel of events for changes made after Watch returns, which is closed after ctx is done.
+// As only one process can open the database, all changes are seen.
+func (b *BoltDataStore) Watch(ctx context.Context) (<-chan Event, error) {
+	return b.watchers.watch(ctx, nil), nil
+}
+
+// BoltData is a [Data] in a [BoltDataStore].
+type BoltData struct {
+	store *BoltDataStore
+	id    ID
+	// lock guards mimeType, which changes when a revision with another MIME type is added through this handle.
+	lock     sync.Mutex
+	mimeType string
+}
+
+var _ Data = (*BoltData)(nil)
+
+func (d *BoltData) ID() ID {
+	return d.id
+}
+
+func (d *BoltData) Revisions() ([]DataRevision, error) {
+	revisions := make([]DataRevision, 0)
+	err := d.store.db.View(func(tx *bolt.Tx) error {
+		bucket := dataBucket(tx, d.id, false)
+		if bucket == nil {
+			return notExist(d.id)
+		}
+		return bucket.Bucket(boltRevisionsBucket).ForEach(func(k, v []byte) error {
+			revisionID := binary.BigEndian.Uint64(k)
+			var meta revisionMeta
+			err := json.Unmarshal(v, &meta)
+			if err != nil {
+				return fmt.Errorf("parse metadata of revision %d: %w", revisionID, err)
+			}
+			revisions = append(revisions, &BoltRevision{d, revisionID, meta})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(revisions, func(a, b DataRevision) int {
+		return b.CreationTime().Compare(a.CreationTime())
+	})
+	return revisions, nil
+}
+
+func (d *BoltData) NewRevision(r io.Reader, opts RevisionOptions) (DataRevision, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var dr *BoltRevision
+	var events []Event
+	err = d.store.db.Update(func(tx *bolt.Tx) error {
+		bucket := dataBucket(tx, d.id, false)
+		if bucket == nil {
+			return notExist(d.id)
+		}
+		// d may be stale, if another handle changed the MIME type
+		current := &BoltData{store: d.store, id: d.id, mimeType: string(bucket.Get(boltMIMETypeKey))}
+		dr, events, err = current.putRevision(bucket, GenerateRandomID().Random, contents, revisionMeta{
+			Author:   opts.Author,
+			Parents:  opts.Parents,
+			MIMEType: opts.MIMEType,
+		})
+		if err != nil {
+			return err
+		}
+		return logChanges(tx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.lock.Lock()
+	d.mimeType = dr.data.mimeType
+	d.lock.Unlock()
+	d.store.watchers.emit(events...)
+	return dr, nil
+}
+
+// putRevision stores a revision in bucket, the bucket of d, and returns the events to log and emit after the transaction.
+// If meta.CreationTime is zero, it is set to the current time, and if meta.MIMEType is empty, it is set to the MIME type of d.
+// If the revision is the latest and has a different MIME type, the MIME type of the data is changed as well.
+func (d *BoltData) putRevision(bucket *bolt.Bucket, revisionID uint64, contents []byte, meta revisionMeta) (*BoltRevision, []Event, error) {
+	if meta.CreationTime.IsZero() {
+		meta.CreationTime = time.Now()
+	}
+	if meta.MIMEType == "" {
+		meta.MIMEType = d.mimeType
+	}
+	events := []Event{{Kind: EventRevision, ID: d.id, RevisionID: revisionID}}
+	if meta.MIMEType != d.mimeType {
+		latest, err := isLatestRevision(bucket, meta.CreationTime)
+		if err != nil {
+			return nil, nil, err
+		}
+		if latest {
+			err = bucket.Put(boltMIMETypeKey, []byte(meta.MIMEType))
+			if err != nil {
+				return nil, nil, err
+			}
+			d = &BoltData{store: d.store, id: d.id, mimeType: meta.MIMEType}
+			events = append(events, Event{Kind: EventMIMEType, ID: d.id, MIMEType: meta.MIMEType})
+		}
+	}
+	sum := sha256.Sum256(contents)
+	meta.SHA256 = hex.EncodeToString(sum[:])
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = bucket.Bucket(boltContentsBucket).Put(revisionKey(revisionID), contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = bucket.Bucket(boltRevisionsBucket).Put(revisionKey(revisionID), raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &BoltRevision{d, revisionID, meta}, events, nil
+}
+
+// isLatestRevision returns whether a revision created at creationTime would be the latest revision in bucket, the bucket of data.
+func isLatestRevision(bucket *bolt.Bucket, creationTime time.Time) (bool, error) {
+	latest := true
+	err := bucket.Bucket(boltRevisionsBucket).ForEach(func(k, v []byte) error {
+		var meta revisionMeta
+		err := json.Unmarshal(v, &meta)
+		if err != nil {
+			return fmt.Errorf("parse metadata of revision %d: %w", binary.BigEndian.Uint64(k), err)
+		}
+		if meta.CreationTime.After(creationTime) {
+			latest = false
+		}
+		return nil
+	})
+	return latest, err
+}
+
+func (d *BoltData) MIMEType() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.mimeType
+}
+
+func (d *BoltData) MarshalJSON() ([]byte, error) {
+	return MarshalData(d)
+}
+
+// BoltRevision is a [DataRevision] in a [BoltDataStore].
+type BoltRevision struct {
+	data       *BoltData
+	revisionID uint64
+	meta       revisionMeta
+}
+
+var _ DataRevision = (*BoltRevision)(nil)
+
+func (r *BoltRevision) Data() Data {
+	return r.data
+}
+
+func (r *BoltRevision) RevisionID() uint64 {
+	return r.revisionID
+}
+
+func (r *BoltRevision) CreationTime() time.Time {
+	return r.meta.CreationTime
+}
+
+func (r *BoltRevision) Author() string {
+	return r.meta.Author
+}
+
+func (r *BoltRevision) Parents() []uint64 {
+	return r.meta.Parents
+}
+
+func (r *BoltRevision) MIMEType() string {
+	if r.meta.MIMEType == "" {
+		return r.data.MIMEType()
+	}
+	return r.meta.MIMEType
+}
+
+// view runs f with the bucket of this revision's data, including trashed data.
+func (r *BoltRevision) view(f func(bucket *bolt.Bucket) error) error {
+	return r.data.store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDataBucket).Bucket([]byte(r.data.id.String()))
+		if bucket == nil {
+			return notExist(r.data.id)
+		}
+		return f(bucket)
+	})
+}
+
+func (r *BoltRevision) NewReadCloser() (io.ReadCloser, error) {
+	var contents []byte
+	err := r.view(func(bucket *bolt.Bucket) error {
+		// values are only valid during the transaction
+		contents = bytes.Clone(bucket.Bucket(boltContentsBucket).Get(revisionKey(r.revisionID)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newVerifyingReadCloser(io.NopCloser(bytes.NewReader(contents)), r.meta.SHA256), nil
+}
+
+func (r *BoltRevision) SHA256() (string, error) {
+	return r.meta.SHA256, nil
+}
+
+func (r *BoltRevision) Traits() Traits {
+	return &boltTraits{r}
+}
+
+type boltTraits struct {
+	r *BoltRevision
+}
+
+func (t *boltTraits) List() ([]string, error) {
+	names := make([]string, 0)
+	err := t.r.view(func(bucket *bolt.Bucket) error {
+		traits := bucket.Bucket(boltTraitsBucket).Bucket(revisionKey(t.r.revisionID))
+		if traits == nil {
+			return nil
+		}
+		return traits.ForEach(func(k, v []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	// bbolt keys are sorted bytewise, as are Go strings
+	return names, err
+}
+
+func (t *boltTraits) Get(name string) (io.ReadCloser, error) {
+	var contents []byte
+	err := t.r.view(func(bucket *bolt.Bucket) error {
+		traits := bucket.Bucket(boltTraitsBucket).Bucket(revisionKey(t.r.revisionID))
+		if traits == nil {
+			return ErrNoSuchTrait
+		}
+		v := traits.Get([]byte(name))
+		if v == nil {
+			return ErrNoSuchTrait
+		}
+		contents = bytes.Clone(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(contents)), nil
+}
+
+func (t *boltTraits) Put(name string, r io.Reader) error {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return t.r.data.store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDataBucket).Bucket([]byte(t.r.data.id.String()))
+		if bucket == nil {
+			return notExist(t.r.data.id)
+		}
+		traits, err := bucket.Bucket(boltTraitsBucket).CreateBucketIfNotExists(revisionKey(t.r.revisionID))
+		if err != nil {
+			return err
+		}
+		return traits.Put([]byte(name), contents)
+	})
+}
@@ -0,0 +1,34 @@
+package data
+
+// Change is an [Event] with its place in the change log of a store.
+type Change struct {
+	Seq uint64
+	Event
+}
+
+// ChangeLog is implemented by [DataStore]s that keep a log of changes.
+// Each change gets a sequence number larger than those of all earlier changes (but not necessarily by one), so clients can ask for the changes since the last one they saw.
+// Changes made before the store kept a log are missing from it.
+type ChangeLog interface {
+	DataStore
+	// Seq returns the sequence number of the latest change, and 0 if there are no changes.
+	Seq() (uint64, error)
+	// Changes returns the changes with a sequence number larger than since, oldest first.
+	Changes(since uint64) ([]Change, error)
+}
+
+// Seq returns the sequence number of the latest change to s, or an error wrapping [ErrNoChangeLog] if s doesn't implement [ChangeLog].
+func Seq(s DataStore) (uint64, error) {
+	if s, ok := s.(ChangeLog); ok {
+		return s.Seq()
+	}
+	return 0, ErrNoChangeLog
+}
+
+// Changes returns the changes to s after since, or an error wrapping [ErrNoChangeLog] if s doesn't implement [ChangeLog].
+func Changes(s DataStore, since uint64) ([]Change, error) {
+	if s, ok := s.(ChangeLog); ok {
+		return s.Changes(since)
+	}
+	return nil, ErrNoChangeLog
+}
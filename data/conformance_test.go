@@ -0,0 +1,42 @@
+package data_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/data/datatest"
+)
+
+func TestFSConformance(t *testing.T) {
+	datatest.RunConformance(t, func(t *testing.T) data.DataStore {
+		return data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	})
+}
+
+func TestShardedFSConformance(t *testing.T) {
+	datatest.RunConformance(t, func(t *testing.T) data.DataStore {
+		store, err := data.InitFSDataStore(t.TempDir(), data.FSLayoutSharded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	datatest.RunConformance(t, func(t *testing.T) data.DataStore {
+		return data.NewMemoryDataStore()
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	datatest.RunConformance(t, func(t *testing.T) data.DataStore {
+		store, err := data.OpenBoltDataStore(filepath.Join(t.TempDir(), "convind.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
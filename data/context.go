@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"io"
+)
+
+// DataStoreContext is implemented by [DataStore]s whose slow operations can be cancelled (e.g. when a client disconnects).
+// Callers should use [AllIDsContext] and [GetDataByIDContext], which also work with other DataStores.
+type DataStoreContext interface {
+	DataStore
+	// AllIDsContext is [DataStore.AllIDs], but stops early with ctx.Err() when ctx is done.
+	AllIDsContext(ctx context.Context) ([]ID, error)
+}
+
+// AllIDsContext returns the IDs of all data in s, stopping early if ctx is done and s implements [DataStoreContext].
+func AllIDsContext(ctx context.Context, s DataStore) ([]ID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s, ok := s.(DataStoreContext); ok {
+		return s.AllIDsContext(ctx)
+	}
+	return s.AllIDs()
+}
+
+// GetDataByIDContext returns the data with the given ID in s, unless ctx is already done.
+func GetDataByIDContext(ctx context.Context, s DataStore, id ID) (Data, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.GetDataByID(id)
+}
+
+// DataContext is implemented by [Data] whose revisions are slow to list (e.g. with metadata in a file per revision).
+// Callers should use [RevisionsContext], which also works with other Data.
+type DataContext interface {
+	Data
+	// RevisionsContext is [Data.Revisions], but stops early with ctx.Err() when ctx is done.
+	RevisionsContext(ctx context.Context) ([]DataRevision, error)
+}
+
+// RevisionsContext returns the revisions of d, stopping early if ctx is done and d implements [DataContext].
+func RevisionsContext(ctx context.Context, d Data) ([]DataRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if d, ok := d.(DataContext); ok {
+		return d.RevisionsContext(ctx)
+	}
+	return d.Revisions()
+}
+
+// LatestRevisionContext is [LatestRevision], but lists revisions with [RevisionsContext].
+func LatestRevisionContext(ctx context.Context, d Data) (DataRevision, error) {
+	revisions, err := RevisionsContext(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	var latestRevision DataRevision
+	for _, revision := range revisions {
+		if latestRevision == nil || revision.CreationTime().After(latestRevision.CreationTime()) {
+			latestRevision = revision
+		}
+	}
+	return latestRevision, nil
+}
+
+// FindRevisionContext is [FindRevision], but lists revisions with [RevisionsContext].
+func FindRevisionContext(ctx context.Context, d Data, revisionID uint64) (DataRevision, error) {
+	revisions, err := RevisionsContext(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		if revision.RevisionID() == revisionID {
+			return revision, nil
+		}
+	}
+	return nil, nil
+}
+
+// NewRevisionContext adds a revision to d like [Data.NewRevision], but fails with ctx.Err() if ctx is done before r is read to the end (e.g. a client disconnecting during an upload).
+// Like other failed writes, the revision is then not created.
+func NewRevisionContext(ctx context.Context, d Data, r io.Reader, opts RevisionOptions) (DataRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.NewRevision(&contextReader{ctx, r}, opts)
+}
+
+// ImportRevisionContext imports a revision into s like [DataStore.ImportRevision], but fails with ctx.Err() if ctx is done before r is read to the end.
+func ImportRevisionContext(ctx context.Context, s DataStore, info RevisionInfo, r io.Reader) (DataRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.ImportRevision(info, &contextReader{ctx, r})
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// NewReadCloserContext returns the contents of dr, which fail to read with ctx.Err() once ctx is done.
+func NewReadCloserContext(ctx context.Context, dr DataRevision) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := dr.NewReadCloser()
+	if err != nil {
+		return nil, err
+	}
+	return &contextReadCloser{ctx, rc}, nil
+}
+
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (c *contextReadCloser) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.ReadCloser.Read(p)
+}
+
+// InstanceContext is implemented by [Instance]s whose contents are expensive to produce (e.g. by running a command).
+type InstanceContext interface {
+	Instance
+	// NewReadCloserContext is [Instance.NewReadCloser], but stops producing the contents when ctx is done.
+	NewReadCloserContext(ctx context.Context) (io.ReadCloser, error)
+}
+
+// NewInstanceReadCloserContext returns the contents of i, stopping early if ctx is done and i implements [InstanceContext].
+func NewInstanceReadCloserContext(ctx context.Context, i Instance) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if i, ok := i.(InstanceContext); ok {
+		return i.NewReadCloserContext(ctx)
+	}
+	return i.NewReadCloser()
+}
+
+// ClassContext is implemented by [Class]es that do slow work to find out whether they apply (e.g. by attempting other classes).
+type ClassContext interface {
+	Class
+	// AttemptInstanceContext is [Class.AttemptInstance], but stops early with ctx.Err() when ctx is done.
+	AttemptInstanceContext(ctx context.Context, dr DataRevision) (Instance, error)
+}
+
+// AttemptInstanceContext returns the instance of c for dr, stopping early if ctx is done and c implements [ClassContext].
+func AttemptInstanceContext(ctx context.Context, c Class, dr DataRevision) (Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c, ok := c.(ClassContext); ok {
+		return c.AttemptInstanceContext(ctx, dr)
+	}
+	return c.AttemptInstance(dr)
+}
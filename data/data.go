@@ -2,6 +2,7 @@ package data
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
@@ -10,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"slices"
 	"time"
 )
 
@@ -69,18 +71,18 @@ func (i *ID) UnmarshalText(rawText []byte) (err error) {
 	decoder := base64.NewDecoder(base64.URLEncoding, bytes.NewBuffer(rawText))
 	text, err := io.ReadAll(decoder)
 	if err != nil {
-		return fmt.Errorf("decode base64: %w", err)
+		return fmt.Errorf("%w: decode base64: %w", ErrInvalidID, err)
 	}
 
 	if len(text) < len(idPrefix)+64/8+64/8 {
-		return errors.New("too short")
+		return fmt.Errorf("%w: too short", ErrInvalidID)
 	}
 	if !bytes.Equal(text[:len(idPrefix)], []byte(idPrefix)) {
-		return errors.New("prefix does not match expected " + idPrefix)
+		return fmt.Errorf("%w: prefix does not match expected %s", ErrInvalidID, idPrefix)
 	}
 	epoch := binary.LittleEndian.Uint64(text[len(idPrefix) : len(idPrefix)+64/8])
 	if epoch > (1<<63 - 1) {
-		return fmt.Errorf("epoch %d too large", epoch)
+		return fmt.Errorf("%w: epoch %d too large", ErrInvalidID, epoch)
 	}
 	i.Epoch = int64(epoch)
 	i.Random = binary.LittleEndian.Uint64(text[len(idPrefix)+64/8 : len(idPrefix)+64/8+64/8])
@@ -88,10 +90,81 @@ func (i *ID) UnmarshalText(rawText []byte) (err error) {
 }
 
 type DataStore interface {
+	// GetDataByID returns the data with the given ID.
+	// If there is no such data, an error wrapping [ErrNotFound] is returned.
 	GetDataByID(ID) (Data, error)
+	// New creates data without any revisions.
+	// If mimeType is empty, application/octet-stream is used.
 	New(mimeType string) (Data, error)
 	AllIDs() ([]ID, error)
+	// DeleteByID moves data into the trash.
+	// Trashed data is excluded from [DataStore.AllIDs] and [DataStore.GetDataByID] until it is restored.
 	DeleteByID(ID) error
+	// Trash returns all trashed data, sorted by deletion time (newest first).
+	Trash() ([]TrashEntry, error)
+	// RestoreByID moves data out of the trash.
+	// It returns an error wrapping [ErrExists] if there is also data with the ID outside the trash.
+	RestoreByID(ID) error
+	// PurgeByID permanently deletes trashed data.
+	// DeleteByID, RestoreByID and PurgeByID return an error wrapping [ErrNotFound] if there is no such (trashed) data.
+	PurgeByID(ID) error
+	// ImportRevision stores a revision created elsewhere (e.g. in another DataStore), keeping its revision ID, creation time and parents.
+	// If there is no data with info.ID, it is created with info.MIMEType (as in [DataStore.New]).
+	// If the revision already exists, it is returned as-is.
+	// If the data is in the trash, ImportRevision returns an error wrapping [ErrTrashed], and the trashed data is left as-is.
+	ImportRevision(info RevisionInfo, r io.Reader) (DataRevision, error)
+}
+
+// DefaultMIMEType is the MIME type of data created without one.
+const DefaultMIMEType = "application/octet-stream"
+
+// TrashEntry describes trashed data.
+type TrashEntry struct {
+	ID           ID
+	MIMEType     string
+	DeletionTime time.Time
+}
+
+// PurgeTrash permanently deletes data that was trashed before the given time, and returns the number of purged data.
+func PurgeTrash(s DataStore, before time.Time) (int, error) {
+	entries, err := s.Trash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, entry := range entries {
+		if !entry.DeletionTime.Before(before) {
+			continue
+		}
+		err = s.PurgeByID(entry.ID)
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RevisionInfo describes a revision independently of the [DataStore] it is stored in.
+type RevisionInfo struct {
+	ID           ID
+	RevisionID   uint64
+	MIMEType     string
+	CreationTime time.Time
+	Author       string
+	Parents      []uint64
+}
+
+// GetRevisionInfo returns the [RevisionInfo] of dr.
+func GetRevisionInfo(dr DataRevision) RevisionInfo {
+	return RevisionInfo{
+		ID:           dr.Data().ID(),
+		RevisionID:   dr.RevisionID(),
+		MIMEType:     dr.MIMEType(),
+		CreationTime: dr.CreationTime(),
+		Author:       dr.Author(),
+		Parents:      dr.Parents(),
+	}
 }
 
 type Data interface {
@@ -99,13 +172,25 @@ type Data interface {
 	// Revisions returns all (known) revisions, sorted newest to oldest.
 	Revisions() ([]DataRevision, error)
 	// NewRevision creates a new revision and returns said revision.
-	NewRevision(r io.Reader) (DataRevision, error)
-	// MIMEType returns the MIME type of this revision.
+	NewRevision(r io.Reader, opts RevisionOptions) (DataRevision, error)
+	// MIMEType returns the MIME type of the latest revision, or the MIME type given to [DataStore.New] if there are no revisions.
+	// A new revision with a different MIME type changes the MIME type of the data, unless it is older than the latest revision (e.g. when imported).
 	MIMEType() string
 	// MarshalJSON implements [json.Marshaler].
 	MarshalJSON() ([]byte, error)
 }
 
+// RevisionOptions are optional metadata for [Data.NewRevision].
+type RevisionOptions struct {
+	// Parents are the revision IDs of the revisions the new revision is based on, and may be empty.
+	Parents []uint64
+	// Author is a free-form description of who created the revision (e.g. an email address), and may be empty.
+	Author string
+	// MIMEType is the MIME type of the new revision (e.g. when a note is converted to Markdown).
+	// If empty, the MIME type of the data is used.
+	MIMEType string
+}
+
 // DataRevision is a handle to a revision of data.
 // All revisions are immutable, and the contents must not change.
 type DataRevision interface {
@@ -115,8 +200,40 @@ type DataRevision interface {
 	RevisionID() uint64
 	// CreationTime returns the time this revision was created.
 	CreationTime() time.Time
+	// Author returns the author of this revision, and an empty string if unknown.
+	Author() string
+	// Parents returns the revision IDs of the revisions this revision is based on.
+	// Revisions with no parents (e.g. the first revision) return an empty slice.
+	// Revisions and their parents form a directed acyclic graph.
+	Parents() []uint64
+	// MIMEType returns the MIME type of this revision.
+	// Revisions created before revisions had their own MIME type return the MIME type of the data.
+	MIMEType() string
 	// NewReadCloser returns an [io.ReadCloser] of this revision.
+	// If the contents do not match [DataRevision.SHA256], reading returns [ErrHashMismatch] instead of [io.EOF].
 	NewReadCloser() (io.ReadCloser, error)
+	// SHA256 returns the SHA-256 hash of the contents of this revision, in lowercase hex.
+	SHA256() (string, error)
+	// Traits returns the traits of this revision.
+	Traits() Traits
+}
+
+// ErrNoSuchTrait is returned by [Traits.Get] when there is no trait with the given name.
+var ErrNoSuchTrait = errors.New("no such trait")
+
+// Traits is the set of traits of a [DataRevision].
+// A trait is additional information about a revision (e.g. a machine-generated caption), usually added by external programs.
+// Unlike the revision itself, traits can be replaced.
+//
+// Traits are identified by name, which should be a domain-and-path combo like [Class.Name].
+type Traits interface {
+	// List returns the names of all traits, sorted.
+	List() ([]string, error)
+	// Get returns an [io.ReadCloser] of the trait with the given name.
+	// If there is no such trait, [ErrNoSuchTrait] is returned.
+	Get(name string) (io.ReadCloser, error)
+	// Put sets the trait with the given name, replacing the existing trait if any.
+	Put(name string, r io.Reader) error
 }
 
 type Class interface {
@@ -124,7 +241,7 @@ type Class interface {
 	// Example: inaba.kiyuri.ca/2025/convind/wiki
 	Name() string
 	// AttemptInstance returns an instance for the given [DataRevision], if applicable.
-	// If not, an error is returned.
+	// If not, an error wrapping [ErrNotApplicable] is returned.
 	// dr must not be nil.
 	AttemptInstance(dr DataRevision) (Instance, error)
 }
@@ -169,23 +286,46 @@ func dataToJSON(d Data) (dataJSON, error) {
 type dataRevisionJSON struct {
 	RevisionID   uint64
 	CreationTime time.Time
+	Author       string
+	Parents      []uint64
+	MIMEType     string
 }
 
 func dataRevisionToJSON(dr DataRevision) dataRevisionJSON {
-	return dataRevisionJSON{dr.RevisionID(), dr.CreationTime()}
+	return dataRevisionJSON{dr.RevisionID(), dr.CreationTime(), dr.Author(), dr.Parents(), dr.MIMEType()}
 }
 
 // LatestRevision returns the latest revision if available, and nil is there are no revisions at all.
 func LatestRevision(d Data) (DataRevision, error) {
+	return LatestRevisionContext(context.Background(), d)
+}
+
+// Heads returns the revisions that are not a parent of any other revision, sorted newest to oldest.
+// Concurrent edits result in multiple heads.
+func Heads(d Data) ([]DataRevision, error) {
 	revisions, err := d.Revisions()
 	if err != nil {
 		return nil, err
 	}
-	var latestRevision DataRevision
+	isParent := map[uint64]bool{}
+	for _, revision := range revisions {
+		for _, parent := range revision.Parents() {
+			isParent[parent] = true
+		}
+	}
+	heads := make([]DataRevision, 0, 1)
 	for _, revision := range revisions {
-		if latestRevision == nil || revision.CreationTime().After(latestRevision.CreationTime()) {
-			latestRevision = revision
+		if !isParent[revision.RevisionID()] {
+			heads = append(heads, revision)
 		}
 	}
-	return latestRevision, nil
+	slices.SortStableFunc(heads, func(a, b DataRevision) int {
+		return b.CreationTime().Compare(a.CreationTime())
+	})
+	return heads, nil
+}
+
+// FindRevision returns the revision of d with the given revision ID, and nil if there is no such revision.
+func FindRevision(d Data, revisionID uint64) (DataRevision, error) {
+	return FindRevisionContext(context.Background(), d, revisionID)
 }
@@ -1,6 +1,9 @@
 package data
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestIDTextMarshaler(t *testing.T) {
 	r := GenerateRandomID()
@@ -20,3 +23,12 @@ func TestIDTextMarshaler(t *testing.T) {
 		t.Fatal("random mismatch")
 	}
 }
+
+func TestParseIDInvalid(t *testing.T) {
+	for _, s := range []string{"", "not an ID", GenerateRandomID().String()[:10]} {
+		_, err := ParseID(s)
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ParseID(%q) = %v, want ErrInvalidID", s, err)
+		}
+	}
+}
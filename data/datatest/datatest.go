@@ -0,0 +1,886 @@
+// Package datatest checks that implementations of [data.DataStore] behave like the ones in this module.
+package datatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// RunConformance runs the conformance suite as subtests of t.
+// newStore must return a new, empty store for each call.
+func RunConformance(t *testing.T, newStore func(t *testing.T) data.DataStore) {
+	tests := []struct {
+		name string
+		f    func(t *testing.T, s data.DataStore)
+	}{
+		{"New", testNew},
+		{"NotFound", testNotFound},
+		{"AllIDs", testAllIDs},
+		{"EmptyData", testEmptyData},
+		{"Revisions", testRevisions},
+		{"RevisionsContext", testRevisionsContext},
+		{"RevisionContents", testRevisionContents},
+		{"Traits", testTraits},
+		{"Delete", testDelete},
+		{"Purge", testPurge},
+		{"ImportRevision", testImportRevision},
+		{"ImportRevisionTrashed", testImportRevisionTrashed},
+		{"RevisionMIMEType", testRevisionMIMEType},
+		{"MarshalJSON", testMarshalJSON},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"Watch", testWatch},
+		{"ChangeLog", testChangeLog},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.f(t, newStore(t))
+		})
+	}
+}
+
+func newData(t *testing.T, s data.DataStore, mimeType string, revisions ...string) data.Data {
+	t.Helper()
+	d, err := s.New(mimeType)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	var parents []uint64
+	for _, contents := range revisions {
+		dr, err := d.NewRevision(strings.NewReader(contents), data.RevisionOptions{Parents: parents})
+		if err != nil {
+			t.Fatalf("NewRevision: %s", err)
+		}
+		parents = []uint64{dr.RevisionID()}
+	}
+	return d
+}
+
+func readAll(t *testing.T, dr data.DataRevision) string {
+	t.Helper()
+	rc, err := dr.NewReadCloser()
+	if err != nil {
+		t.Fatalf("NewReadCloser: %s", err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read revision: %s", err)
+	}
+	return string(b)
+}
+
+func testNew(t *testing.T, s data.DataStore) {
+	a := newData(t, s, "text/markdown")
+	b := newData(t, s, "")
+	if a.ID() == b.ID() {
+		t.Fatalf("New returned the same ID twice: %s", a.ID())
+	}
+	if a.MIMEType() != "text/markdown" {
+		t.Errorf("MIMEType = %q, want text/markdown", a.MIMEType())
+	}
+	if b.MIMEType() != "application/octet-stream" {
+		t.Errorf("MIMEType of data created without a MIME type = %q, want application/octet-stream", b.MIMEType())
+	}
+	got, err := s.GetDataByID(a.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID: %s", err)
+	}
+	if got.ID() != a.ID() || got.MIMEType() != a.MIMEType() {
+		t.Errorf("GetDataByID = %s (%s), want %s (%s)", got.ID(), got.MIMEType(), a.ID(), a.MIMEType())
+	}
+}
+
+func testNotFound(t *testing.T, s data.DataStore) {
+	id := data.GenerateRandomID()
+	_, err := s.GetDataByID(id)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("GetDataByID of missing data: got %v, want data.ErrNotFound", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetDataByID of missing data: got %v, want os.ErrNotExist", err)
+	}
+	err = s.DeleteByID(id)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("DeleteByID of missing data: got %v, want data.ErrNotFound", err)
+	}
+	err = s.RestoreByID(id)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("RestoreByID of missing data: got %v, want data.ErrNotFound", err)
+	}
+	err = s.PurgeByID(id)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("PurgeByID of missing data: got %v, want data.ErrNotFound", err)
+	}
+}
+
+func testAllIDs(t *testing.T, s data.DataStore) {
+	ids, err := s.AllIDs()
+	if err != nil {
+		t.Fatalf("AllIDs: %s", err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("AllIDs of empty store = %v", ids)
+	}
+	want := make([]string, 3)
+	for i := range want {
+		want[i] = newData(t, s, "text/plain", "x").ID().String()
+	}
+	// data without revisions is listed too
+	want = append(want, newData(t, s, "text/plain").ID().String())
+	ids, err = s.AllIDs()
+	if err != nil {
+		t.Fatalf("AllIDs: %s", err)
+	}
+	got := make([]string, len(ids))
+	for i, id := range ids {
+		got[i] = id.String()
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("AllIDs = %v, want %v", got, want)
+	}
+
+	ids, err = data.AllIDsContext(context.Background(), s)
+	if err != nil {
+		t.Fatalf("AllIDsContext: %s", err)
+	}
+	if len(ids) != len(want) {
+		t.Errorf("AllIDsContext returned %d IDs, want %d", len(ids), len(want))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = data.AllIDsContext(ctx, s)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("AllIDsContext with a canceled context: %v", err)
+	}
+}
+
+// cancelingReader returns a chunk per read, and cancels its context after the first.
+type cancelingReader struct {
+	chunks [][]byte
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	r.cancel()
+	return n, nil
+}
+
+func testRevisionsContext(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "a", "b")
+	revisions, err := data.RevisionsContext(context.Background(), d)
+	if err != nil {
+		t.Fatalf("RevisionsContext: %s", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("RevisionsContext returned %d revisions, want 2", len(revisions))
+	}
+	latest, err := data.LatestRevisionContext(context.Background(), d)
+	if err != nil || latest.RevisionID() != revisions[0].RevisionID() {
+		t.Fatalf("LatestRevisionContext = %v, %v", latest, err)
+	}
+
+	// an upload interrupted by the context doesn't create a revision
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancelingReader{[][]byte{[]byte("first"), []byte("second")}, cancel}
+	_, err = data.NewRevisionContext(ctx, d, r, data.RevisionOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("NewRevisionContext canceled while reading: %v", err)
+	}
+	_, err = data.RevisionsContext(ctx, d)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("RevisionsContext with a canceled context: %v", err)
+	}
+	revisions, err = d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("canceled NewRevisionContext created a revision")
+	}
+}
+
+func testEmptyData(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain")
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != 0 {
+		t.Errorf("Revisions of new data = %v", revisions)
+	}
+	latest, err := data.LatestRevision(d)
+	if err != nil {
+		t.Fatalf("LatestRevision: %s", err)
+	}
+	if latest != nil {
+		t.Errorf("LatestRevision of new data = %v, want nil", latest)
+	}
+	dr, err := data.FindRevision(d, 1)
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	if dr != nil {
+		t.Errorf("FindRevision of new data = %v, want nil", dr)
+	}
+}
+
+func testRevisions(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "1", "2", "3")
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("got %d revisions, want 3", len(revisions))
+	}
+	seen := map[uint64]bool{}
+	for i, revision := range revisions {
+		if seen[revision.RevisionID()] {
+			t.Errorf("duplicate revision ID %d", revision.RevisionID())
+		}
+		seen[revision.RevisionID()] = true
+		if revision.CreationTime().IsZero() {
+			t.Errorf("revision %d has no creation time", revision.RevisionID())
+		}
+		if i > 0 && revision.CreationTime().After(revisions[i-1].CreationTime()) {
+			t.Errorf("revisions are not sorted newest to oldest: %s after %s", revision.CreationTime(), revisions[i-1].CreationTime())
+		}
+		if revision.Data().ID() != d.ID() {
+			t.Errorf("Data().ID() = %s, want %s", revision.Data().ID(), d.ID())
+		}
+	}
+	latest, err := data.LatestRevision(d)
+	if err != nil {
+		t.Fatalf("LatestRevision: %s", err)
+	}
+	if got := readAll(t, latest); got != "3" {
+		t.Errorf("LatestRevision contents = %q, want 3", got)
+	}
+	heads, err := data.Heads(d)
+	if err != nil {
+		t.Fatalf("Heads: %s", err)
+	}
+	if len(heads) != 1 || heads[0].RevisionID() != latest.RevisionID() {
+		t.Errorf("Heads = %v, want only the latest revision", heads)
+	}
+	found, err := data.FindRevision(d, revisions[1].RevisionID())
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	if found == nil || readAll(t, found) != "2" {
+		t.Errorf("FindRevision did not find the middle revision")
+	}
+
+	// handles from GetDataByID see the same revisions
+	d2, err := s.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID: %s", err)
+	}
+	revisions2, err := d2.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions2) != 3 {
+		t.Errorf("got %d revisions through GetDataByID, want 3", len(revisions2))
+	}
+}
+
+func testRevisionContents(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "application/octet-stream")
+	contents := []byte("binary\x00contents\xff")
+	before := time.Now().Add(-time.Second)
+	dr, err := d.NewRevision(bytes.NewReader(contents), data.RevisionOptions{Author: "someone@example.com", Parents: []uint64{1, 2}})
+	if err != nil {
+		t.Fatalf("NewRevision: %s", err)
+	}
+	found, err := data.FindRevision(d, dr.RevisionID())
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	for name, dr := range map[string]data.DataRevision{"returned": dr, "found": found} {
+		if got := readAll(t, dr); got != string(contents) {
+			t.Errorf("%s: contents = %q, want %q", name, got, contents)
+		}
+		// reading twice works as well
+		if got := readAll(t, dr); got != string(contents) {
+			t.Errorf("%s: contents on second read = %q, want %q", name, got, contents)
+		}
+		sum := sha256.Sum256(contents)
+		hash, err := dr.SHA256()
+		if err != nil {
+			t.Errorf("%s: SHA256: %s", name, err)
+		} else if hash != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: SHA256 = %s, want %s", name, hash, hex.EncodeToString(sum[:]))
+		}
+		if dr.Author() != "someone@example.com" {
+			t.Errorf("%s: Author = %q", name, dr.Author())
+		}
+		if !slices.Equal(dr.Parents(), []uint64{1, 2}) {
+			t.Errorf("%s: Parents = %v", name, dr.Parents())
+		}
+		if dr.CreationTime().Before(before) {
+			t.Errorf("%s: CreationTime = %s, before the revision was created", name, dr.CreationTime())
+		}
+	}
+}
+
+func testTraits(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "a", "b")
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	traits := revisions[0].Traits()
+	names, err := traits.List()
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("List of new revision = %v", names)
+	}
+	_, err = traits.Get("example.com/missing")
+	if !errors.Is(err, data.ErrNoSuchTrait) {
+		t.Errorf("Get of missing trait: got %v, want ErrNoSuchTrait", err)
+	}
+	for _, name := range []string{"example.com/b", "example.com/a", "example.com/a"} {
+		err = traits.Put(name, strings.NewReader(name+" value"))
+		if err != nil {
+			t.Fatalf("Put: %s", err)
+		}
+	}
+	err = traits.Put("example.com/b", strings.NewReader("replaced"))
+	if err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	names, err = traits.List()
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if !slices.Equal(names, []string{"example.com/a", "example.com/b"}) {
+		t.Errorf("List = %v", names)
+	}
+	for name, want := range map[string]string{"example.com/a": "example.com/a value", "example.com/b": "replaced"} {
+		rc, err := traits.Get(name)
+		if err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read trait: %s", err)
+		}
+		if string(b) != want {
+			t.Errorf("trait %s = %q, want %q", name, b, want)
+		}
+	}
+	other, err := revisions[1].Traits().List()
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(other) != 0 {
+		t.Errorf("traits leaked to another revision: %v", other)
+	}
+}
+
+func testDelete(t *testing.T, s data.DataStore) {
+	kept := newData(t, s, "text/plain", "kept")
+	deleted := newData(t, s, "text/markdown", "deleted")
+	err := s.DeleteByID(deleted.ID())
+	if err != nil {
+		t.Fatalf("DeleteByID: %s", err)
+	}
+	ids, err := s.AllIDs()
+	if err != nil {
+		t.Fatalf("AllIDs: %s", err)
+	}
+	if len(ids) != 1 || ids[0] != kept.ID() {
+		t.Errorf("AllIDs after delete = %v, want only %s", ids, kept.ID())
+	}
+	_, err = s.GetDataByID(deleted.ID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("GetDataByID of deleted data: got %v, want data.ErrNotFound", err)
+	}
+	err = s.DeleteByID(deleted.ID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("DeleteByID of deleted data: got %v, want data.ErrNotFound", err)
+	}
+	trash, err := s.Trash()
+	if err != nil {
+		t.Fatalf("Trash: %s", err)
+	}
+	if len(trash) != 1 || trash[0].ID != deleted.ID() || trash[0].MIMEType != "text/markdown" || trash[0].DeletionTime.IsZero() {
+		t.Fatalf("Trash = %v", trash)
+	}
+
+	err = s.RestoreByID(deleted.ID())
+	if err != nil {
+		t.Fatalf("RestoreByID: %s", err)
+	}
+	restored, err := s.GetDataByID(deleted.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID of restored data: %s", err)
+	}
+	latest, err := data.LatestRevision(restored)
+	if err != nil {
+		t.Fatalf("LatestRevision: %s", err)
+	}
+	if latest == nil || readAll(t, latest) != "deleted" {
+		t.Errorf("restored data lost its revisions")
+	}
+	trash, err = s.Trash()
+	if err != nil {
+		t.Fatalf("Trash: %s", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("Trash after restore = %v", trash)
+	}
+}
+
+func testPurge(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "purged")
+	err := s.PurgeByID(d.ID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("PurgeByID of data not in trash: got %v, want data.ErrNotFound", err)
+	}
+	err = s.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatalf("DeleteByID: %s", err)
+	}
+	n, err := data.PurgeTrash(s, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeTrash: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("PurgeTrash purged %d data deleted just now", n)
+	}
+	err = s.PurgeByID(d.ID())
+	if err != nil {
+		t.Fatalf("PurgeByID: %s", err)
+	}
+	trash, err := s.Trash()
+	if err != nil {
+		t.Fatalf("Trash: %s", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("Trash after purge = %v", trash)
+	}
+	err = s.RestoreByID(d.ID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("RestoreByID of purged data: got %v, want data.ErrNotFound", err)
+	}
+}
+
+func testImportRevision(t *testing.T, s data.DataStore) {
+	info := data.RevisionInfo{
+		ID:           data.GenerateRandomID(),
+		RevisionID:   12345,
+		MIMEType:     "text/markdown",
+		CreationTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Author:       "someone@example.com",
+		Parents:      []uint64{42},
+	}
+	dr, err := s.ImportRevision(info, strings.NewReader("imported"))
+	if err != nil {
+		t.Fatalf("ImportRevision: %s", err)
+	}
+	check := func(name string, dr data.DataRevision) {
+		got := data.GetRevisionInfo(dr)
+		if got.ID != info.ID || got.RevisionID != info.RevisionID || got.MIMEType != info.MIMEType || !got.CreationTime.Equal(info.CreationTime) || got.Author != info.Author || !slices.Equal(got.Parents, info.Parents) {
+			t.Errorf("%s: RevisionInfo = %+v, want %+v", name, got, info)
+		}
+		if contents := readAll(t, dr); contents != "imported" {
+			t.Errorf("%s: contents = %q", name, contents)
+		}
+	}
+	check("imported", dr)
+	d, err := s.GetDataByID(info.ID)
+	if err != nil {
+		t.Fatalf("GetDataByID of imported data: %s", err)
+	}
+	found, err := data.FindRevision(d, info.RevisionID)
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	if found == nil {
+		t.Fatalf("imported revision not found")
+	}
+	check("found", found)
+
+	// importing again is a no-op
+	dr, err = s.ImportRevision(info, strings.NewReader("ignored"))
+	if err != nil {
+		t.Fatalf("ImportRevision again: %s", err)
+	}
+	check("imported again", dr)
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("got %d revisions after importing twice, want 1", len(revisions))
+	}
+}
+
+func testImportRevisionTrashed(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "a")
+	err := s.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatalf("DeleteByID: %s", err)
+	}
+	info := data.RevisionInfo{ID: d.ID(), RevisionID: 12345, MIMEType: "text/plain", CreationTime: time.Now()}
+	_, err = s.ImportRevision(info, strings.NewReader("b"))
+	if !errors.Is(err, data.ErrTrashed) {
+		t.Fatalf("ImportRevision into trashed data: %v", err)
+	}
+	_, err = s.GetDataByID(d.ID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetDataByID after ImportRevision into trashed data: %v", err)
+	}
+	err = s.RestoreByID(d.ID())
+	if err != nil {
+		t.Fatalf("RestoreByID: %s", err)
+	}
+	d, err = s.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID: %s", err)
+	}
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("restored data has %d revisions", len(revisions))
+	}
+}
+
+func testRevisionMIMEType(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "plain")
+	plain, err := data.LatestRevision(d)
+	if err != nil {
+		t.Fatalf("LatestRevision: %s", err)
+	}
+	if plain.MIMEType() != "text/plain" {
+		t.Fatalf("MIMEType of revision created without one = %q, want text/plain", plain.MIMEType())
+	}
+	markdown, err := d.NewRevision(strings.NewReader("# converted"), data.RevisionOptions{MIMEType: "text/markdown"})
+	if err != nil {
+		t.Fatalf("NewRevision: %s", err)
+	}
+	if markdown.MIMEType() != "text/markdown" || d.MIMEType() != "text/markdown" {
+		t.Fatalf("MIMEType of revision = %q, of data = %q, want text/markdown", markdown.MIMEType(), d.MIMEType())
+	}
+	got, err := s.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID: %s", err)
+	}
+	if got.MIMEType() != "text/markdown" {
+		t.Fatalf("MIMEType of data after GetDataByID = %q, want text/markdown", got.MIMEType())
+	}
+	old, err := data.FindRevision(got, plain.RevisionID())
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	if old.MIMEType() != "text/plain" {
+		t.Fatalf("MIMEType of older revision = %q, want text/plain", old.MIMEType())
+	}
+	next, err := got.NewRevision(strings.NewReader("# edited"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatalf("NewRevision: %s", err)
+	}
+	if next.MIMEType() != "text/markdown" {
+		t.Fatalf("MIMEType of revision created without one after converting = %q, want text/markdown", next.MIMEType())
+	}
+
+	// older revisions (e.g. from another store) don't change the MIME type of the data
+	_, err = s.ImportRevision(data.RevisionInfo{
+		ID:           d.ID(),
+		RevisionID:   12345,
+		MIMEType:     "image/png",
+		CreationTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, strings.NewReader("png"))
+	if err != nil {
+		t.Fatalf("ImportRevision: %s", err)
+	}
+	got, err = s.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatalf("GetDataByID: %s", err)
+	}
+	if got.MIMEType() != "text/markdown" {
+		t.Fatalf("MIMEType of data after importing an older revision = %q, want text/markdown", got.MIMEType())
+	}
+	imported, err := data.FindRevision(got, 12345)
+	if err != nil {
+		t.Fatalf("FindRevision: %s", err)
+	}
+	if imported.MIMEType() != "image/png" {
+		t.Fatalf("MIMEType of imported revision = %q, want image/png", imported.MIMEType())
+	}
+
+	if _, ok := s.(data.ChangeLog); !ok {
+		return
+	}
+	changes, err := data.Changes(s, 0)
+	if err != nil {
+		t.Fatalf("Changes: %s", err)
+	}
+	n := 0
+	for _, change := range changes {
+		if change.Kind == data.EventMIMEType {
+			n++
+			if change.MIMEType != "text/markdown" {
+				t.Errorf("change of MIME type to %q", change.MIMEType)
+			}
+		}
+	}
+	if n != 1 {
+		t.Fatalf("%d changes of MIME type, want 1", n)
+	}
+}
+
+func testMarshalJSON(t *testing.T, s data.DataStore) {
+	d := newData(t, s, "text/plain", "a", "b")
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	var got struct {
+		ID        data.ID
+		Revisions []struct{ RevisionID uint64 }
+		MIMEType  string
+	}
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if got.ID != d.ID() || got.MIMEType != "text/plain" || len(got.Revisions) != 2 {
+		t.Errorf("MarshalJSON = %s", b)
+	}
+}
+
+func testConcurrentWriters(t *testing.T, s data.DataStore) {
+	const writers = 8
+	const revisionsPerWriter = 5
+	shared := newData(t, s, "text/plain")
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			own, err := s.New("text/plain")
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j := 0; j < revisionsPerWriter; j++ {
+				contents := fmt.Sprintf("writer %d revision %d", i, j)
+				_, err = shared.NewRevision(strings.NewReader(contents), data.RevisionOptions{})
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = own.NewRevision(strings.NewReader(contents), data.RevisionOptions{})
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = shared.Revisions()
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write: %s", err)
+	}
+	revisions, err := shared.Revisions()
+	if err != nil {
+		t.Fatalf("Revisions: %s", err)
+	}
+	if len(revisions) != writers*revisionsPerWriter {
+		t.Errorf("got %d revisions, want %d", len(revisions), writers*revisionsPerWriter)
+	}
+	contents := map[string]bool{}
+	for _, revision := range revisions {
+		contents[readAll(t, revision)] = true
+	}
+	if len(contents) != writers*revisionsPerWriter {
+		t.Errorf("got %d distinct contents, want %d", len(contents), writers*revisionsPerWriter)
+	}
+	ids, err := s.AllIDs()
+	if err != nil {
+		t.Fatalf("AllIDs: %s", err)
+	}
+	if len(ids) != writers+1 {
+		t.Errorf("got %d data, want %d", len(ids), writers+1)
+	}
+}
+
+func testWatch(t *testing.T, s data.DataStore) {
+	if _, ok := s.(data.Watcher); !ok {
+		t.Skip("not a data.Watcher")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := data.Watch(ctx, s)
+	if err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	// the same event may be sent more than once
+	var last data.Event
+	next := func() data.Event {
+		t.Helper()
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					t.Fatal("events closed early")
+				}
+				if e == last {
+					continue
+				}
+				last = e
+				return e
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+
+	d := newData(t, s, "text/plain")
+	if e := next(); e != (data.Event{Kind: data.EventNew, ID: d.ID(), MIMEType: "text/plain"}) {
+		t.Fatalf("event after New = %+v", e)
+	}
+	dr, err := d.NewRevision(strings.NewReader("x"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatalf("NewRevision: %s", err)
+	}
+	if e := next(); e != (data.Event{Kind: data.EventRevision, ID: d.ID(), RevisionID: dr.RevisionID()}) {
+		t.Fatalf("event after NewRevision = %+v", e)
+	}
+	err = s.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatalf("DeleteByID: %s", err)
+	}
+	if e := next(); e != (data.Event{Kind: data.EventDelete, ID: d.ID()}) {
+		t.Fatalf("event after DeleteByID = %+v", e)
+	}
+	err = s.RestoreByID(d.ID())
+	if err != nil {
+		t.Fatalf("RestoreByID: %s", err)
+	}
+	if e := next(); e != (data.Event{Kind: data.EventNew, ID: d.ID(), MIMEType: "text/plain"}) {
+		t.Fatalf("event after RestoreByID = %+v", e)
+	}
+
+	cancel()
+	for range events {
+		// drain until closed
+	}
+}
+
+func testChangeLog(t *testing.T, s data.DataStore) {
+	if _, ok := s.(data.ChangeLog); !ok {
+		t.Skip("not a data.ChangeLog")
+	}
+	seq, err := data.Seq(s)
+	if err != nil {
+		t.Fatalf("Seq: %s", err)
+	}
+	if seq != 0 {
+		t.Fatalf("Seq of empty store = %d", seq)
+	}
+
+	d := newData(t, s, "text/plain", "x")
+	mid, err := data.Seq(s)
+	if err != nil {
+		t.Fatalf("Seq: %s", err)
+	}
+	if mid == 0 {
+		t.Fatal("Seq didn't increase after New")
+	}
+	err = s.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatalf("DeleteByID: %s", err)
+	}
+	last, err := data.Seq(s)
+	if err != nil {
+		t.Fatalf("Seq: %s", err)
+	}
+	if last <= mid {
+		t.Fatalf("Seq didn't increase after DeleteByID: %d, then %d", mid, last)
+	}
+
+	changes, err := data.Changes(s, 0)
+	if err != nil {
+		t.Fatalf("Changes: %s", err)
+	}
+	kinds := make([]data.EventKind, len(changes))
+	for i, change := range changes {
+		if change.ID != d.ID() {
+			t.Errorf("change %d is for %s", i, change.ID)
+		}
+		if i > 0 && change.Seq <= changes[i-1].Seq {
+			t.Errorf("change %d has Seq %d after %d", i, change.Seq, changes[i-1].Seq)
+		}
+		kinds[i] = change.Kind
+	}
+	if !slices.Equal(kinds, []data.EventKind{data.EventNew, data.EventRevision, data.EventDelete}) {
+		t.Fatalf("kinds of changes = %v", kinds)
+	}
+	if changes[1].Seq != mid || changes[2].Seq != last {
+		t.Fatalf("Seqs of changes = %d, %d; Seq returned %d, %d", changes[1].Seq, changes[2].Seq, mid, last)
+	}
+
+	changes, err = data.Changes(s, mid)
+	if err != nil {
+		t.Fatalf("Changes: %s", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != data.EventDelete {
+		t.Fatalf("Changes since %d = %+v", mid, changes)
+	}
+	changes, err = data.Changes(s, last)
+	if err != nil {
+		t.Fatalf("Changes: %s", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Changes since the latest = %+v", changes)
+	}
+
+	err = s.PurgeByID(d.ID())
+	if err != nil {
+		t.Fatalf("PurgeByID: %s", err)
+	}
+	changes, err = data.Changes(s, last)
+	if err != nil {
+		t.Fatalf("Changes: %s", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != data.EventPurge || changes[0].ID != d.ID() {
+		t.Fatalf("Changes after PurgeByID = %+v", changes)
+	}
+}
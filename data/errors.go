@@ -0,0 +1,43 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNotFound is returned (wrapped) when there is no data with the given ID.
+// It also matches [os.ErrNotExist], so code checking for that keeps working.
+var ErrNotFound error = notFoundError{}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "not found" }
+
+func (notFoundError) Is(target error) bool { return target == os.ErrNotExist }
+
+func notExist(id ID) error {
+	return fmt.Errorf("data %s: %w", id, ErrNotFound)
+}
+
+// ErrNoRevisions is returned (wrapped) when a revision is needed, but the data has no revisions yet.
+var ErrNoRevisions = errors.New("no revisions")
+
+// ErrInvalidID is returned (wrapped) by [ParseID] and [ID.UnmarshalText] when the text is not an ID.
+var ErrInvalidID = errors.New("invalid ID")
+
+// ErrNoSuchClass is returned (wrapped) when there is no class with the given name.
+var ErrNoSuchClass = errors.New("no such class")
+
+// ErrNotApplicable is returned (wrapped) by [Class.AttemptInstance] when the class has no instance for the revision.
+var ErrNotApplicable = errors.New("class not applicable")
+
+// ErrTrashed is returned (wrapped) by [DataStore.ImportRevision] when the data is in the trash.
+// Restore the data first to add revisions to it.
+var ErrTrashed = errors.New("in the trash")
+
+// ErrExists is returned (wrapped) when data with the ID already exists, e.g. by [DataStore.RestoreByID] when the data was imported again after it was deleted.
+var ErrExists = errors.New("already exists")
+
+// ErrNoChangeLog is returned (wrapped) for stores that don't keep a change log (see [ChangeLog]).
+var ErrNoChangeLog = errors.New("store has no change log")
@@ -1,96 +1,216 @@
 package data
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type FSDataStore struct {
 	prefix string
+	layout FSLayout
+
+	// watchLock guards watch, which is only set while there are watchers.
+	watchLock sync.Mutex
+	watch     *fsWatch
+	watchers  watchers
 }
 
-var _ DataStore = (*FSDataStore)(nil)
+var (
+	_ DataStoreContext = (*FSDataStore)(nil)
+	_ Watcher          = (*FSDataStore)(nil)
+	_ ChangeLog        = (*FSDataStore)(nil)
+)
 
 // NewFSDataStoreFromSubdirectory returns a new FSDataStore using [os.DirFS].
+// The layout is read from the store marker (see [OpenFSDataStore]), and the flat layout is assumed if the marker cannot be read.
 func NewFSDataStoreFromSubdirectory(directory string) *FSDataStore {
-	return &FSDataStore{directory}
+	marker, err := readStoreMarker(directory)
+	if err != nil {
+		marker.Layout = FSLayoutFlat
+	}
+	return &FSDataStore{prefix: directory, layout: marker.Layout}
 }
 
 func (f *FSDataStore) GetDataByID(id ID) (Data, error) {
-	_, err := os.Stat(filepath.Join(f.prefix, id.String()))
+	dir, err := f.locate(id)
 	if err != nil {
 		return nil, err
 	}
-	raw, err := os.ReadFile(filepath.Join(f.prefix, id.String(), ".datatype"))
+	raw, err := os.ReadFile(filepath.Join(dir, ".datatype"))
 	if errors.Is(err, os.ErrNotExist) {
-		raw = []byte("application/octet-stream")
+		raw = []byte(DefaultMIMEType)
 	} else if err != nil {
 		return nil, fmt.Errorf("reading .datatype: %w", err)
 	}
-	return &FSData{f.prefix, id, string(raw)}, nil
+	return &FSData{prefix: f.prefix, dir: dir, id: id, mimeType: string(raw)}, nil
 }
 
 func (f *FSDataStore) New(mimeType string) (Data, error) {
-	id := GenerateRandomID()
-	err := os.Mkdir(filepath.Join(f.prefix, id.String()), 0700)
+	return f.createData(GenerateRandomID(), mimeType)
+}
+
+// createData creates the directory for data with the given ID.
+// The directory is prepared under a temporary name and then renamed, so that data without a .datatype file is never visible.
+func (f *FSDataStore) createData(id ID, mimeType string) (*FSData, error) {
+	if mimeType == "" {
+		mimeType = DefaultMIMEType
+	}
+	tmp, err := os.MkdirTemp(f.prefix, ".tmp-")
 	if err != nil {
 		return nil, err
 	}
-	err = os.WriteFile(filepath.Join(f.prefix, id.String(), ".datatype"), []byte(mimeType), 0600)
+	defer os.RemoveAll(tmp)
+	err = writeFileAtomic(filepath.Join(tmp, ".datatype"), []byte(mimeType))
 	if err != nil {
 		return nil, err
 	}
-	return &FSData{f.prefix, id, mimeType}, nil
+	dir := f.dataDir(id, f.layout)
+	err = os.MkdirAll(filepath.Dir(dir), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmp, dir)
+	if err != nil {
+		return nil, err
+	}
+	err = syncDir(filepath.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	err = appendChange(f.prefix, Event{Kind: EventNew, ID: id, MIMEType: mimeType})
+	if err != nil {
+		return nil, err
+	}
+	return &FSData{prefix: f.prefix, dir: dir, id: id, mimeType: mimeType}, nil
 }
 
+// AllIDs returns the IDs of all data, in both layouts.
 func (f *FSDataStore) AllIDs() ([]ID, error) {
+	return f.AllIDsContext(context.Background())
+}
+
+// AllIDsContext is [FSDataStore.AllIDs], but stops between shards when ctx is done.
+func (f *FSDataStore) AllIDsContext(ctx context.Context) ([]ID, error) {
 	entries, err := os.ReadDir(f.prefix)
 	if err != nil {
 		return nil, err
 	}
-	ids := make([]ID, len(entries))
-	for i, entry := range entries {
+	ids := make([]ID, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name()[0] == '.' {
+			continue
+		}
+		if isShardName(entry.Name()) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			ids, err = appendIDs(ids, filepath.Join(f.prefix, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		id, err := ParseID(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// appendIDs appends the IDs of the data directories in the shard directory dir to ids.
+func appendIDs(ids []ID, dir string) ([]ID, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
 		if entry.Name()[0] == '.' {
 			continue
 		}
-		ids[i], err = ParseID(entry.Name())
+		id, err := ParseID(entry.Name())
 		if err != nil {
 			return nil, err
 		}
+		ids = append(ids, id)
 	}
 	return ids, nil
 }
 
-func (f *FSDataStore) DeleteByID(id ID) error {
-	return os.RemoveAll(filepath.Join(f.prefix, id.String()))
+func (f *FSDataStore) ImportRevision(info RevisionInfo, r io.Reader) (DataRevision, error) {
+	d, err := f.GetDataByID(info.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		_, err = os.Stat(f.trashPath(info.ID))
+		if err == nil {
+			return nil, fmt.Errorf("data %s: %w", info.ID, ErrTrashed)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		d, err = f.createData(info.ID, info.MIMEType)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	existing, err := FindRevision(d, info.RevisionID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+	return d.(*FSData).newRevision(r, info.RevisionID, revisionMeta{
+		CreationTime: info.CreationTime,
+		Author:       info.Author,
+		Parents:      info.Parents,
+		MIMEType:     info.MIMEType,
+	})
 }
 
 type FSData struct {
-	prefix   string
-	id       ID
+	prefix string
+	// dir is the directory of this data
+	dir string
+	id  ID
+	// lock guards mimeType, which changes when a revision with another MIME type is added through this handle.
+	lock     sync.Mutex
 	mimeType string
 }
 
-var _ Data = (*FSData)(nil)
+var _ DataContext = (*FSData)(nil)
 
 func (f *FSData) ID() ID {
 	return f.id
 }
 
 func (f *FSData) Revisions() ([]DataRevision, error) {
-	entries, err := os.ReadDir(filepath.Join(f.prefix, f.id.String()))
+	return f.RevisionsContext(context.Background())
+}
+
+// RevisionsContext is [FSData.Revisions], but stops between revisions when ctx is done.
+func (f *FSData) RevisionsContext(ctx context.Context) ([]DataRevision, error) {
+	entries, err := os.ReadDir(f.dir)
 	if err != nil {
 		return nil, err
 	}
 	revisions := make([]DataRevision, 0, len(entries))
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if entry.Name()[0] != '.' {
 			revisionID, err := strconv.ParseUint(entry.Name(), 10, 64)
 			if err != nil {
@@ -100,31 +220,178 @@ func (f *FSData) Revisions() ([]DataRevision, error) {
 			if err != nil {
 				return nil, fmt.Errorf("stat %s", entry.Name())
 			}
-			revisions = append(revisions, &FSRevision{f.prefix, f.id, info, revisionID, f.mimeType})
+			meta, err := f.readRevisionMeta(revisionID)
+			if err != nil {
+				return nil, err
+			}
+			revisions = append(revisions, &FSRevision{f.prefix, f.dir, f.id, info, revisionID, f.MIMEType(), meta})
 		}
 	}
+	slices.SortStableFunc(revisions, func(a, b DataRevision) int {
+		return b.CreationTime().Compare(a.CreationTime())
+	})
 	return revisions, nil
 }
 
-func (f *FSData) NewRevision(r io.Reader) (DataRevision, error) {
-	revisionID := GenerateRandomID().Random
-	file, err := os.Create(filepath.Join(f.prefix, f.id.String(), strconv.FormatUint(revisionID, 10)))
+func (f *FSData) NewRevision(r io.Reader, opts RevisionOptions) (DataRevision, error) {
+	return f.newRevision(r, GenerateRandomID().Random, revisionMeta{
+		Author:   opts.Author,
+		Parents:  opts.Parents,
+		MIMEType: opts.MIMEType,
+	})
+}
+
+// newRevision creates a revision with the given revision ID and metadata.
+// If meta.CreationTime is zero, it is set to the current time, and if meta.MIMEType is empty, it is set to the MIME type of f.
+// If the revision is the latest and has a different MIME type, the .datatype file of the data is replaced after the revision is written.
+//
+// The contents are stored in a content-addressed blob (see [blobPath]).
+// The revision file itself is left empty, and only marks the existence of the revision.
+//
+// Each file is written to a temporary (dot) file, synced, and renamed into place, in the order blob, metadata, revision file.
+// So, if writing fails or is interrupted (e.g. r returns an error or the machine crashes), the revision is not visible in [FSData.Revisions];
+// at most an unreferenced blob or metadata file is left behind, which [FSDataStore.Check] can clean up.
+func (f *FSData) newRevision(r io.Reader, revisionID uint64, meta revisionMeta) (DataRevision, error) {
+	var err error
+	if meta.CreationTime.IsZero() {
+		meta.CreationTime = time.Now()
+	}
+	if meta.MIMEType == "" {
+		meta.MIMEType = f.MIMEType()
+	}
+	changeMIMEType := false
+	if meta.MIMEType != f.MIMEType() {
+		latest, err := LatestRevision(f)
+		if err != nil {
+			return nil, err
+		}
+		changeMIMEType = latest == nil || !latest.CreationTime().After(meta.CreationTime)
+	}
+	meta.SHA256, err = writeBlob(f.prefix, r)
+	if err != nil {
+		return nil, err
+	}
+	err = f.writeRevisionMeta(revisionID, meta)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(f.dir, strconv.FormatUint(revisionID, 10))
+	err = writeFileAtomic(path, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	_, err = io.Copy(file, r)
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	info, err := file.Stat()
+	err = appendChange(f.prefix, Event{Kind: EventRevision, ID: f.id, RevisionID: revisionID})
 	if err != nil {
 		return nil, err
 	}
-	return &FSRevision{f.prefix, f.id, info, revisionID, f.mimeType}, nil
+	if changeMIMEType {
+		err = writeFileAtomic(filepath.Join(f.dir, ".datatype"), []byte(meta.MIMEType))
+		if err != nil {
+			return nil, err
+		}
+		f.lock.Lock()
+		f.mimeType = meta.MIMEType
+		f.lock.Unlock()
+		err = appendChange(f.prefix, Event{Kind: EventMIMEType, ID: f.id, MIMEType: meta.MIMEType})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FSRevision{f.prefix, f.dir, f.id, info, revisionID, f.MIMEType(), meta}, nil
 }
 
-func (f *FSData) MIMEType() string { return strings.TrimSpace(f.mimeType) }
+// revisionMeta is metadata about a revision, stored next to the revision itself.
+// Revisions created before metadata was stored have no metadata, and revisions created before some fields were added have zero values for them.
+// [FSDataStore.MigrateMetadata] fills in missing fields.
+type revisionMeta struct {
+	// CreationTime is the time the revision was created.
+	// If zero, the modification time of the revision file is used instead.
+	CreationTime time.Time
+	Author       string
+	Parents      []uint64
+	// MIMEType is the MIME type of the data at the time the revision was created.
+	MIMEType string
+	// SHA256 is the hash of the contents, which are stored in the blob with this hash.
+	// If empty, the revision was created before content-addressed storage, and the contents are in the revision file itself.
+	SHA256 string
+}
+
+func (f *FSData) revisionMetaPath(revisionID uint64) string {
+	return filepath.Join(f.dir, "."+strconv.FormatUint(revisionID, 10)+".meta")
+}
+
+// readRevisionMeta returns the metadata of the given revision.
+// Revisions created before metadata was stored get empty metadata.
+func (f *FSData) readRevisionMeta(revisionID uint64) (revisionMeta, error) {
+	var meta revisionMeta
+	raw, err := os.ReadFile(f.revisionMetaPath(revisionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	} else if err != nil {
+		return meta, fmt.Errorf("read metadata of revision %d: %w", revisionID, err)
+	}
+	err = json.Unmarshal(raw, &meta)
+	if err != nil {
+		return meta, fmt.Errorf("parse metadata of revision %d: %w", revisionID, err)
+	}
+	return meta, nil
+}
+
+func (f *FSData) writeRevisionMeta(revisionID uint64, meta revisionMeta) error {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.revisionMetaPath(revisionID), raw)
+}
+
+// writeFileAtomic writes b to a temporary file which is then renamed to path, so that readers see either the old file or the complete new file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs the directory at path, so that renames into it are durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (f *FSData) MIMEType() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return strings.TrimSpace(f.mimeType)
+}
 
 func (f *FSData) MarshalJSON() ([]byte, error) {
 	return MarshalData(f)
@@ -132,14 +399,16 @@ func (f *FSData) MarshalJSON() ([]byte, error) {
 
 type FSRevision struct {
 	prefix     string
+	dir        string
 	id         ID
 	info       fs.FileInfo
 	revisionID uint64
 	mimeType   string
+	meta       revisionMeta
 }
 
 func (f *FSRevision) Data() Data {
-	return &FSData{f.prefix, f.id, f.mimeType}
+	return &FSData{prefix: f.prefix, dir: f.dir, id: f.id, mimeType: f.mimeType}
 }
 
 // RevisionID is a unique number representing this revision.
@@ -149,10 +418,54 @@ func (f *FSRevision) RevisionID() uint64 {
 }
 
 // CreationTime returns the time this revision was created.
+// For revisions without a recorded creation time, the modification time of the revision file is used.
 func (f *FSRevision) CreationTime() time.Time {
+	if !f.meta.CreationTime.IsZero() {
+		return f.meta.CreationTime
+	}
 	return f.info.ModTime()
 }
 
+// Author returns the author of this revision, and an empty string if unknown.
+func (f *FSRevision) Author() string {
+	return f.meta.Author
+}
+
+// Parents returns the revision IDs of the revisions this revision is based on.
+func (f *FSRevision) Parents() []uint64 {
+	return f.meta.Parents
+}
+
+// MIMEType returns the MIME type of this revision.
+// For revisions without a recorded MIME type, the MIME type of the data is used.
+func (f *FSRevision) MIMEType() string {
+	if f.meta.MIMEType == "" {
+		return strings.TrimSpace(f.mimeType)
+	}
+	return f.meta.MIMEType
+}
+
 func (f *FSRevision) NewReadCloser() (io.ReadCloser, error) {
-	return os.Open(filepath.Join(f.prefix, f.id.String(), strconv.FormatUint(f.revisionID, 10)))
+	if f.meta.SHA256 == "" {
+		return os.Open(filepath.Join(f.dir, strconv.FormatUint(f.revisionID, 10)))
+	}
+	rc, err := os.Open(blobPath(f.prefix, f.meta.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	return newVerifyingReadCloser(rc, f.meta.SHA256), nil
+}
+
+// SHA256 returns the SHA-256 hash of the contents of this revision, in lowercase hex.
+// For revisions created before content-addressed storage, the hash is computed from the contents.
+func (f *FSRevision) SHA256() (string, error) {
+	if f.meta.SHA256 != "" {
+		return f.meta.SHA256, nil
+	}
+	rc, err := f.NewReadCloser()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return hashReader(rc)
 }
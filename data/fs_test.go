@@ -0,0 +1,493 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSRevisionParents(t *testing.T) {
+	store := NewFSDataStoreFromSubdirectory(t.TempDir())
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := d.NewRevision(strings.NewReader("base"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := d.NewRevision(strings.NewReader("a"), RevisionOptions{Parents: []uint64{base.RevisionID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.NewRevision(strings.NewReader("b"), RevisionOptions{Parents: []uint64{base.RevisionID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = store.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FindRevision(d, a.RevisionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Parents(), []uint64{base.RevisionID()}) {
+		t.Fatalf("parents = %v, want [%d]", got.Parents(), base.RevisionID())
+	}
+	heads, err := Heads(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headIDs := make([]uint64, len(heads))
+	for i, head := range heads {
+		headIDs[i] = head.RevisionID()
+	}
+	slices.Sort(headIDs)
+	want := []uint64{a.RevisionID(), b.RevisionID()}
+	slices.Sort(want)
+	if !slices.Equal(headIDs, want) {
+		t.Fatalf("heads = %v, want %v", headIDs, want)
+	}
+}
+
+func TestFSTraits(t *testing.T) {
+	store := NewFSDataStoreFromSubdirectory(t.TempDir())
+	d, err := store.New("image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("png"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "example.com/caption"
+	_, err = dr.Traits().Get(name)
+	if !errors.Is(err, ErrNoSuchTrait) {
+		t.Fatalf("Get before Put: %v", err)
+	}
+	for _, caption := range []string{"a cat", "a small cat"} {
+		err = dr.Traits().Put(name, strings.NewReader(caption))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := dr.Traits().Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != caption {
+			t.Fatalf("trait = %q, want %q", got, caption)
+		}
+	}
+	names, err := dr.Traits().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{name}) {
+		t.Fatalf("names = %v", names)
+	}
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("traits are listed as revisions: %d revisions", len(revisions))
+	}
+}
+
+func TestFSContentAddressed(t *testing.T) {
+	prefix := t.TempDir()
+	store := NewFSDataStoreFromSubdirectory(prefix)
+	var revisions []DataRevision
+	for range 2 {
+		d, err := store.New("image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dr, err := d.NewRevision(strings.NewReader("same contents"), RevisionOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		revisions = append(revisions, dr)
+	}
+	a, err := revisions[0].SHA256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := revisions[1].SHA256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || a != "82b7d6ca0cb5816c140f1b8988bedab0cec48368fd1f0decfeea329730fc2c49" {
+		t.Fatalf("hashes = %s and %s", a, b)
+	}
+	blobs, err := filepath.Glob(filepath.Join(prefix, ".blobs", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 {
+		t.Fatalf("identical contents stored as %d blobs", len(blobs))
+	}
+	ids, err := store.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("AllIDs returned %d IDs", len(ids))
+	}
+
+	err = os.WriteFile(blobs[0], []byte("corrupted"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := revisions[0].NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	_, err = io.ReadAll(rc)
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("reading corrupted revision: %v", err)
+	}
+}
+
+func TestFSMetadata(t *testing.T) {
+	prefix := t.TempDir()
+	store := NewFSDataStoreFromSubdirectory(prefix)
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("new"), RevisionOptions{Author: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a legacy revision, with contents in the revision file and creation time as its modification time
+	legacyTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	legacyPath := filepath.Join(prefix, d.ID().String(), "42")
+	err = os.WriteFile(legacyPath, []byte("legacy"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(legacyPath, legacyTime, legacyTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := store.MigrateMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Fatalf("migrated %d revisions", migrated)
+	}
+	// e.g. copying the store without preserving modification times
+	now := time.Now()
+	for _, name := range []string{"42", strconv.FormatUint(dr.RevisionID(), 10)} {
+		err = os.Chtimes(filepath.Join(prefix, d.ID().String(), name), now, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy, err := FindRevision(d, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !legacy.CreationTime().Equal(legacyTime) {
+		t.Fatalf("legacy creation time = %s", legacy.CreationTime())
+	}
+	rc, err := legacy.NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "legacy" {
+		t.Fatalf("legacy content = %q", content)
+	}
+	got, err := FindRevision(d, dr.RevisionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreationTime().Equal(dr.CreationTime()) {
+		t.Fatalf("creation time = %s, want %s", got.CreationTime(), dr.CreationTime())
+	}
+	if got.Author() != "a@example.com" {
+		t.Fatalf("author = %q", got.Author())
+	}
+}
+
+// failingReader returns some bytes, then fails, like an interrupted upload.
+type failingReader struct {
+	n int
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errInterrupted
+	}
+	n := min(len(p), r.n)
+	for i := range n {
+		p[i] = 'x'
+	}
+	r.n -= n
+	return n, nil
+}
+
+func TestFSNewRevisionReaderFailure(t *testing.T) {
+	prefix := t.TempDir()
+	store := NewFSDataStoreFromSubdirectory(prefix)
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := d.NewRevision(strings.NewReader("good"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(&failingReader{100000}, RevisionOptions{})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("NewRevision: %v", err)
+	}
+	_, err = store.ImportRevision(RevisionInfo{ID: d.ID(), RevisionID: 1, MIMEType: "text/plain"}, &failingReader{10})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("ImportRevision: %v", err)
+	}
+
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("%d revisions after failed writes", len(revisions))
+	}
+	latest, err := LatestRevision(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.RevisionID() != good.RevisionID() {
+		t.Fatal("partially written revision became the latest revision")
+	}
+	problems, err := store.Check(CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("failed writes left behind %v", problems)
+	}
+}
+
+func TestFSTrash(t *testing.T) {
+	store := NewFSDataStoreFromSubdirectory(t.TempDir())
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(strings.NewReader("trashed"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := store.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("AllIDs = %v, want none", ids)
+	}
+	_, err = store.GetDataByID(d.ID())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("GetDataByID: %v", err)
+	}
+	trash, err := store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != d.ID() || trash[0].MIMEType != "text/plain" {
+		t.Fatalf("Trash = %v", trash)
+	}
+	problems, err := store.Check(CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("blobs of trashed data should be kept: %v", problems)
+	}
+
+	// data with the same ID outside the trash isn't overwritten
+	dir := store.dataDir(d.ID(), store.layout)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.RestoreByID(d.ID())
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("RestoreByID over existing data: got %v, want ErrExists", err)
+	}
+	err = os.Remove(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.RestoreByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := store.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := LatestRevision(d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := dr.NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "trashed" {
+		t.Fatalf("restored contents = %q", b)
+	}
+
+	err = store.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	purged, err := PurgeTrash(store, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 0 {
+		t.Fatalf("purged %d data trashed just now", purged)
+	}
+	purged, err = PurgeTrash(store, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Fatalf("purged %d, want 1", purged)
+	}
+	trash, err = store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 0 {
+		t.Fatalf("Trash after purge = %v", trash)
+	}
+}
+
+func TestFSRelayout(t *testing.T) {
+	prefix := t.TempDir()
+	store := NewFSDataStoreFromSubdirectory(prefix)
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(strings.NewReader("flat"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := store.Relayout(FSLayoutSharded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Fatalf("moved %d, want 1", moved)
+	}
+	_, err = os.Stat(filepath.Join(prefix, shardName(d.ID()), d.ID().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenFSDataStore(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Layout() != FSLayoutSharded {
+		t.Fatalf("Layout = %s", reopened.Layout())
+	}
+
+	// data left in the old layout (e.g. by an interrupted relayout) is still readable
+	err = os.Rename(filepath.Join(prefix, shardName(d.ID()), d.ID().String()), filepath.Join(prefix, d.ID().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharded, err := reopened.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sharded.NewRevision(strings.NewReader("sharded"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := reopened.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("AllIDs = %v", ids)
+	}
+	for _, id := range ids {
+		d, err := reopened.GetDataByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dr, err := LatestRevision(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dr == nil {
+			t.Fatalf("%s has no revisions", id)
+		}
+	}
+	problems, err := reopened.Check(CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("problems = %v", problems)
+	}
+
+	moved, err = reopened.Relayout(FSLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Fatalf("moved %d back, want 1", moved)
+	}
+	entries, err := os.ReadDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if isShardName(entry.Name()) {
+			t.Fatalf("empty shard %s not removed", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// changesName is the name of the change log of an [FSDataStore], in the root of the store.
+// It has one [Event] as JSON per line, and the sequence number of a change is the offset of the end of its line.
+// Lines are appended in one write each, so other processes never see half a line, except after a crash.
+const changesName = ".changes"
+
+// appendChange adds e to the change log of the store at prefix.
+func appendChange(prefix string, e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(prefix, changesName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open change log: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(raw, '\n'))
+	if err != nil {
+		return fmt.Errorf("append to change log: %w", err)
+	}
+	return file.Sync()
+}
+
+// Seq returns the sequence number of the latest change, which is the size of the change log.
+func (f *FSDataStore) Seq() (uint64, error) {
+	info, err := os.Stat(filepath.Join(f.prefix, changesName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return uint64(info.Size()), nil
+}
+
+// Changes returns the changes after since.
+// Lines that cannot be parsed (e.g. half a line left by a crash while appending, followed by the next line) are skipped.
+func (f *FSDataStore) Changes(since uint64) ([]Change, error) {
+	changes := make([]Change, 0)
+	file, err := os.Open(filepath.Join(f.prefix, changesName))
+	if errors.Is(err, os.ErrNotExist) {
+		return changes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	offset := uint64(0)
+	br := bufio.NewReader(file)
+	if since > 0 {
+		// since may be in the middle of a line, so start at the line after the one containing since-1
+		_, err = file.Seek(int64(since-1), io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		skipped, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return changes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		offset = since - 1 + uint64(len(skipped))
+	}
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return changes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		offset += uint64(len(line))
+		change := Change{Seq: offset}
+		if json.Unmarshal(line, &change.Event) != nil {
+			continue
+		}
+		changes = append(changes, change)
+	}
+}
@@ -0,0 +1,389 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProblemKind is a kind of inconsistency found by [FSDataStore.Check].
+type ProblemKind string
+
+const (
+	// ProblemMalformedID is an entry in the store root that is not a valid ID.
+	ProblemMalformedID ProblemKind = "malformed-id"
+	// ProblemMissingDatatype is data without a .datatype file.
+	ProblemMissingDatatype ProblemKind = "missing-datatype"
+	// ProblemEmptyData is data without any revisions.
+	ProblemEmptyData ProblemKind = "empty-data"
+	// ProblemMalformedRevision is a file in a data directory whose name is not a revision ID.
+	ProblemMalformedRevision ProblemKind = "malformed-revision"
+	// ProblemMalformedMetadata is revision metadata that cannot be parsed.
+	ProblemMalformedMetadata ProblemKind = "malformed-metadata"
+	// ProblemEmptyRevision is a zero-length revision without a content hash, which is usually the result of an interrupted write.
+	ProblemEmptyRevision ProblemKind = "empty-revision"
+	// ProblemMissingBlob is a revision whose blob does not exist.
+	ProblemMissingBlob ProblemKind = "missing-blob"
+	// ProblemHashMismatch is a revision whose blob does not match its content hash.
+	ProblemHashMismatch ProblemKind = "hash-mismatch"
+	// ProblemUnreferencedBlob is a blob not used by any revision, e.g. after data is purged from the trash.
+	ProblemUnreferencedBlob ProblemKind = "unreferenced-blob"
+	// ProblemOrphanMetadata is revision metadata without a revision, left behind by an interrupted write.
+	ProblemOrphanMetadata ProblemKind = "orphan-metadata"
+	// ProblemTemporaryFile is a temporary file left behind by an interrupted write.
+	ProblemTemporaryFile ProblemKind = "temporary-file"
+)
+
+// Problem is an inconsistency found by [FSDataStore.Check].
+type Problem struct {
+	Kind ProblemKind
+	// Path is the path of the offending file or directory, relative to the root of the store.
+	Path string
+	// Detail is a human-readable description of the problem.
+	Detail string
+	// Action is what was done about the problem, and empty if nothing was done.
+	Action string
+	// Resolved is true if Action succeeded.
+	Resolved bool
+}
+
+func (p Problem) String() string {
+	s := fmt.Sprintf("%s: %s", p.Kind, p.Path)
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	if p.Action != "" {
+		s += " (" + p.Action + ")"
+	}
+	return s
+}
+
+// CheckOptions configures [FSDataStore.Check].
+type CheckOptions struct {
+	// Repair fixes problems that can be fixed without losing data:
+	// missing .datatype files are created with application/octet-stream (the type assumed when reading),
+	// and unreferenced blobs, orphan metadata and temporary files are deleted.
+	// As temporary files of in-progress writes are deleted too, only repair while nothing else is writing to the store.
+	Repair bool
+	// Quarantine moves entries with problems that cannot be repaired into the .quarantine directory in the store, so that the rest of the store can be read.
+	Quarantine bool
+}
+
+// Check walks the store, and returns all problems found.
+// Depending on opts, problems are also repaired or quarantined.
+func (f *FSDataStore) Check(opts CheckOptions) ([]Problem, error) {
+	c := &checker{
+		f:              f,
+		opts:           opts,
+		quarantineDir:  filepath.Join(f.prefix, ".quarantine", time.Now().UTC().Format("20060102T150405Z")),
+		referencedBlob: map[string]bool{},
+		blobOK:         map[string]error{},
+	}
+	entries, err := os.ReadDir(f.prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if isShardName(entry.Name()) && entry.IsDir() {
+			shardEntries, err := os.ReadDir(filepath.Join(f.prefix, entry.Name()))
+			if err != nil {
+				return c.problems, err
+			}
+			for _, shardEntry := range shardEntries {
+				err = c.checkEntry(entry.Name(), shardEntry)
+				if err != nil {
+					return c.problems, err
+				}
+			}
+			continue
+		}
+		err = c.checkEntry("", entry)
+		if err != nil {
+			return c.problems, err
+		}
+	}
+	err = c.referenceTrashedBlobs()
+	if err != nil {
+		return c.problems, err
+	}
+	err = c.checkBlobs()
+	return c.problems, err
+}
+
+// checkEntry checks an entry of the store root (if dir is empty) or of a shard directory.
+func (c *checker) checkEntry(dir string, entry os.DirEntry) error {
+	path := filepath.Join(dir, entry.Name())
+	if strings.HasPrefix(entry.Name(), ".tmp-") {
+		c.remove(Problem{Kind: ProblemTemporaryFile, Path: path})
+		return nil
+	}
+	if entry.Name()[0] == '.' {
+		return nil
+	}
+	_, err := ParseID(entry.Name())
+	if err != nil || !entry.IsDir() {
+		detail := "not a directory"
+		if err != nil {
+			detail = err.Error()
+		}
+		c.quarantine(Problem{Kind: ProblemMalformedID, Path: path, Detail: detail})
+		return nil
+	}
+	return c.checkData(path)
+}
+
+// referenceTrashedBlobs marks blobs used by trashed data as referenced, so that they are kept until the data is purged.
+// Trashed data is otherwise not checked.
+func (c *checker) referenceTrashedBlobs() error {
+	paths, err := filepath.Glob(filepath.Join(c.f.prefix, ".trash", "*", ".*.meta"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var meta revisionMeta
+		if json.Unmarshal(raw, &meta) == nil && meta.SHA256 != "" {
+			c.referencedBlob[meta.SHA256] = true
+		}
+	}
+	return nil
+}
+
+type checker struct {
+	f              *FSDataStore
+	opts           CheckOptions
+	quarantineDir  string
+	problems       []Problem
+	referencedBlob map[string]bool
+	// blobOK caches the result of verifying each blob, as blobs can be shared between revisions
+	blobOK map[string]error
+}
+
+// quarantine records p, and moves the files at paths (relative to the store root) into the quarantine directory if enabled.
+// If no paths are given, p.Path is moved.
+func (c *checker) quarantine(p Problem, paths ...string) {
+	if len(paths) == 0 {
+		paths = []string{p.Path}
+	}
+	if c.opts.Quarantine {
+		p.Action = "quarantined"
+		p.Resolved = true
+		for _, path := range paths {
+			err := moveFile(filepath.Join(c.f.prefix, path), filepath.Join(c.quarantineDir, path))
+			if err != nil {
+				p.Action = "quarantine failed: " + err.Error()
+				p.Resolved = false
+				break
+			}
+		}
+	}
+	c.problems = append(c.problems, p)
+}
+
+// moveFile moves src to dst.
+// If both are directories (e.g. a data directory that had some revisions quarantined already), their contents are merged.
+func moveFile(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		// e.g. optional metadata
+		return nil
+	} else if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err == nil && srcInfo.IsDir() && dstInfo.IsDir() {
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = moveFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		return os.Remove(src)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0700)
+	if err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+func (c *checker) checkData(name string) error {
+	dir := filepath.Join(c.f.prefix, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(filepath.Join(dir, ".datatype"))
+	if errors.Is(err, os.ErrNotExist) {
+		p := Problem{Kind: ProblemMissingDatatype, Path: name}
+		if c.opts.Repair {
+			p.Action = "created with application/octet-stream"
+			p.Resolved = true
+			err = os.WriteFile(filepath.Join(dir, ".datatype"), []byte(DefaultMIMEType), 0600)
+			if err != nil {
+				p.Action = "repair failed: " + err.Error()
+				p.Resolved = false
+			}
+		}
+		c.problems = append(c.problems, p)
+	} else if err != nil {
+		return err
+	}
+
+	revisions := 0
+	for _, entry := range entries {
+		path := filepath.Join(name, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			c.remove(Problem{Kind: ProblemTemporaryFile, Path: path})
+			continue
+		}
+		if revisionName, ok := strings.CutSuffix(entry.Name(), ".meta"); ok && strings.HasPrefix(revisionName, ".") {
+			_, err := os.Stat(filepath.Join(dir, revisionName[1:]))
+			if errors.Is(err, os.ErrNotExist) {
+				c.remove(Problem{Kind: ProblemOrphanMetadata, Path: path})
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name()[0] == '.' {
+			continue
+		}
+		_, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || entry.IsDir() {
+			c.quarantine(Problem{Kind: ProblemMalformedRevision, Path: path})
+			continue
+		}
+		ok, err := c.checkRevision(name, entry.Name())
+		if err != nil {
+			return err
+		}
+		if ok {
+			revisions++
+		}
+	}
+	if revisions == 0 {
+		c.quarantine(Problem{Kind: ProblemEmptyData, Path: name})
+	}
+	return nil
+}
+
+// checkRevision checks a revision, and returns true if the revision is fine.
+func (c *checker) checkRevision(dataName, revisionName string) (bool, error) {
+	path := filepath.Join(dataName, revisionName)
+	metaPath := filepath.Join(dataName, "."+revisionName+".meta")
+	info, err := os.Stat(filepath.Join(c.f.prefix, path))
+	if err != nil {
+		return false, err
+	}
+
+	var meta revisionMeta
+	raw, err := os.ReadFile(filepath.Join(c.f.prefix, metaPath))
+	if err == nil {
+		err = json.Unmarshal(raw, &meta)
+		if err != nil {
+			c.quarantine(Problem{Kind: ProblemMalformedMetadata, Path: metaPath, Detail: err.Error()}, path, metaPath)
+			return false, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	if meta.SHA256 == "" {
+		if info.Size() == 0 {
+			c.quarantine(Problem{Kind: ProblemEmptyRevision, Path: path}, path, metaPath)
+			return false, nil
+		}
+		return true, nil
+	}
+	c.referencedBlob[meta.SHA256] = true
+	err = c.verifyBlob(meta.SHA256)
+	if errors.Is(err, os.ErrNotExist) {
+		c.quarantine(Problem{Kind: ProblemMissingBlob, Path: path, Detail: meta.SHA256}, path, metaPath)
+		return false, nil
+	} else if errors.Is(err, ErrHashMismatch) {
+		// the blob is quarantined too, as it is corrupted for every revision using it
+		relBlobPath, relErr := filepath.Rel(c.f.prefix, blobPath(c.f.prefix, meta.SHA256))
+		if relErr != nil {
+			return false, relErr
+		}
+		c.quarantine(Problem{Kind: ProblemHashMismatch, Path: path, Detail: err.Error()}, path, metaPath, relBlobPath)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *checker) verifyBlob(sha256Hex string) error {
+	if err, ok := c.blobOK[sha256Hex]; ok {
+		return err
+	}
+	err := func() error {
+		f, err := os.Open(blobPath(c.f.prefix, sha256Hex))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		got, err := hashReader(f)
+		if err != nil {
+			return err
+		}
+		if got != sha256Hex {
+			return fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, sha256Hex, got)
+		}
+		return nil
+	}()
+	c.blobOK[sha256Hex] = err
+	return err
+}
+
+func (c *checker) checkBlobs() error {
+	blobsDir := filepath.Join(c.f.prefix, ".blobs")
+	return filepath.WalkDir(blobsDir, func(path string, d os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == blobsDir {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() || c.referencedBlob[d.Name()] {
+			return nil
+		}
+		rel, err := filepath.Rel(c.f.prefix, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			c.remove(Problem{Kind: ProblemTemporaryFile, Path: rel})
+		} else if d.Name()[0] != '.' {
+			c.remove(Problem{Kind: ProblemUnreferencedBlob, Path: rel})
+		}
+		return nil
+	})
+}
+
+// remove records p, and deletes the file at p.Path if repairing is enabled.
+func (c *checker) remove(p Problem) {
+	if c.opts.Repair {
+		p.Action = "deleted"
+		p.Resolved = true
+		err := os.RemoveAll(filepath.Join(c.f.prefix, p.Path))
+		if err != nil {
+			p.Action = "delete failed: " + err.Error()
+			p.Resolved = false
+		}
+	}
+	c.problems = append(c.problems, p)
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFSCheck(t *testing.T) {
+	prefix := t.TempDir()
+	store := NewFSDataStoreFromSubdirectory(prefix)
+	good, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = good.NewRevision(strings.NewReader("good"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := corrupted.NewRevision(strings.NewReader("will be corrupted"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Hex, err := dr.SHA256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(blobPath(prefix, sha256Hex), []byte("corrupted"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = good.NewRevision(strings.NewReader("good 2"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(prefix, good.ID().String(), "not-a-revision"), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(prefix, good.ID().String(), "123"), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not the metadata of a revision, and ignored like other dot files
+	err = os.WriteFile(filepath.Join(prefix, good.ID().String(), ".meta"), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(prefix, good.ID().String(), ".datatype"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = deleted.NewRevision(strings.NewReader("deleted"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteByID(deleted.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.PurgeByID(deleted.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(prefix, "stray"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := store.Check(CheckOptions{Repair: true, Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make([]string, len(problems))
+	for i, p := range problems {
+		if !p.Resolved {
+			t.Errorf("not resolved: %s", p)
+		}
+		kinds[i] = string(p.Kind)
+	}
+	slices.Sort(kinds)
+	want := []string{
+		string(ProblemEmptyData),
+		string(ProblemEmptyRevision),
+		string(ProblemHashMismatch),
+		string(ProblemMalformedID),
+		string(ProblemMalformedRevision),
+		string(ProblemMissingDatatype),
+		string(ProblemUnreferencedBlob),
+	}
+	slices.Sort(want)
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("problems = %v", problems)
+	}
+
+	problems, err = store.Check(CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("problems after repair: %v", problems)
+	}
+	ids, err := store.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []ID{good.ID()}) {
+		t.Fatalf("ids after repair = %v", ids)
+	}
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch returns a channel of events for changes made after Watch returns (also by other processes), which is closed after ctx is done.
+// Changes are noticed using inotify (or the equivalent of the OS), with a watch per data directory.
+// If watching fails (e.g. when there are more data than the inotify watch limit), the store is polled every [DefaultPollInterval] instead.
+//
+// All calls share one set of watches, which is removed when the last watcher is done.
+func (f *FSDataStore) Watch(ctx context.Context) (<-chan Event, error) {
+	f.watchLock.Lock()
+	if f.watch == nil {
+		w, err := f.startWatch()
+		if err != nil {
+			f.watchLock.Unlock()
+			return PollWatch(ctx, f, DefaultPollInterval)
+		}
+		f.watch = w
+	}
+	ch := f.watchers.watch(ctx, f.stopWatchIfUnused)
+	f.watchLock.Unlock()
+	return ch, nil
+}
+
+func (f *FSDataStore) stopWatchIfUnused() {
+	f.watchLock.Lock()
+	defer f.watchLock.Unlock()
+	if f.watch != nil && f.watchers.len() == 0 {
+		f.watch.w.Close()
+		f.watch = nil
+	}
+}
+
+// fsWatch turns filesystem events in an [FSDataStore] into [Event]s.
+// After startWatch, its fields are only used by its goroutine.
+type fsWatch struct {
+	f *FSDataStore
+	w *fsnotify.Watcher
+	// dirs has the ID of each watched data directory.
+	dirs map[string]ID
+	// paths has the directory of each known data.
+	// When data is moved (e.g. by [FSDataStore.Relayout]), it is updated before the new directory is watched, so moving is not reported.
+	paths map[ID]string
+}
+
+func (f *FSDataStore) startWatch() (*fsWatch, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	x := &fsWatch{f, w, map[string]ID{}, map[ID]string{}}
+	err = x.addRoot()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	go x.run()
+	return x, nil
+}
+
+// addRoot watches the root of the store, and all shards and data directories in it.
+func (x *fsWatch) addRoot() error {
+	err := x.w.Add(x.f.prefix)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(x.f.prefix)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(x.f.prefix, entry.Name())
+		if isShardName(entry.Name()) {
+			err = x.addShard(path, false)
+		} else if id, err2 := ParseID(entry.Name()); err2 == nil {
+			err = x.addData(path, id, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addShard watches a shard directory, and the data directories in it.
+// Data directories are reported as new if report is true.
+func (x *fsWatch) addShard(path string, report bool) error {
+	err := x.w.Add(path)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if id, err := ParseID(entry.Name()); err == nil {
+			err = x.addData(filepath.Join(path, entry.Name()), id, report)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addData watches a data directory.
+// Unless the data was known already (i.e. it was moved), it is reported as new if report is true, together with its revisions, which may have been created before the watch was added.
+func (x *fsWatch) addData(path string, id ID, report bool) error {
+	if _, ok := x.dirs[path]; ok {
+		return nil
+	}
+	err := x.w.Add(path)
+	if err != nil {
+		return err
+	}
+	x.dirs[path] = id
+	_, known := x.paths[id]
+	x.paths[id] = path
+	if known || !report {
+		return nil
+	}
+	x.f.watchers.emit(Event{Kind: EventNew, ID: id, MIMEType: readMIMEType(path)})
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if revisionID, err := strconv.ParseUint(entry.Name(), 10, 64); err == nil {
+			x.f.watchers.emit(Event{Kind: EventRevision, ID: id, RevisionID: revisionID})
+		}
+	}
+	return nil
+}
+
+// removeData is called when a data directory is removed or renamed.
+func (x *fsWatch) removeData(path string) {
+	id, ok := x.dirs[path]
+	if !ok {
+		return
+	}
+	delete(x.dirs, path)
+	// fails if the directory doesn't exist anymore, which is fine
+	x.w.Remove(path)
+	if x.paths[id] != path {
+		// already seen in its new directory
+		return
+	}
+	newPath, err := x.f.locate(id)
+	if err == nil {
+		// moved; the event for the new directory follows
+		x.paths[id] = newPath
+		return
+	}
+	delete(x.paths, id)
+	x.f.watchers.emit(Event{Kind: EventDelete, ID: id})
+}
+
+func readMIMEType(dir string) string {
+	raw, err := os.ReadFile(filepath.Join(dir, ".datatype"))
+	if err != nil {
+		return DefaultMIMEType
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func (x *fsWatch) run() {
+	for {
+		select {
+		case e, ok := <-x.w.Events:
+			if !ok {
+				return
+			}
+			x.handle(e)
+		case _, ok := <-x.w.Errors:
+			// e.g. the event queue overflowed; there's no way to tell what was missed
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (x *fsWatch) handle(e fsnotify.Event) {
+	dir, name := filepath.Split(e.Name)
+	dir = filepath.Clean(dir)
+	// temporary files, metadata, blobs and the trash (but not the MIME type) start with a dot
+	if strings.HasPrefix(name, ".") && name != ".datatype" {
+		return
+	}
+	created := e.Has(fsnotify.Create)
+	removed := e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename)
+	if id, ok := x.dirs[dir]; ok {
+		// in a data directory
+		if !created {
+			return
+		}
+		if name == ".datatype" {
+			x.f.watchers.emit(Event{Kind: EventMIMEType, ID: id, MIMEType: readMIMEType(dir)})
+		} else if revisionID, err := strconv.ParseUint(name, 10, 64); err == nil {
+			x.f.watchers.emit(Event{Kind: EventRevision, ID: id, RevisionID: revisionID})
+		}
+		return
+	}
+	inRoot := dir == filepath.Clean(x.f.prefix)
+	inShard := filepath.Dir(dir) == filepath.Clean(x.f.prefix) && isShardName(filepath.Base(dir))
+	if inRoot && isShardName(name) {
+		if created {
+			// errors (e.g. the watch limit) mean changes in the shard are missed, but there is no one to report them to
+			x.addShard(e.Name, true)
+		}
+		return
+	}
+	id, err := ParseID(name)
+	if err != nil || !(inRoot || inShard) {
+		return
+	}
+	if removed {
+		x.removeData(e.Name)
+	}
+	if created {
+		if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+			x.addData(e.Name, id, true)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FSLayout is how an [FSDataStore] arranges data directories.
+type FSLayout string
+
+const (
+	// FSLayoutFlat puts each data directory directly in the root of the store (<root>/<id>).
+	FSLayoutFlat FSLayout = "flat"
+	// FSLayoutSharded puts each data directory in a directory per month of its ID's epoch (<root>/2006-01/<id>), so that no directory gets too large.
+	FSLayoutSharded FSLayout = "sharded"
+)
+
+// storeMarkerName is the name of the file in the root of an [FSDataStore] describing the store.
+// Stores without it are flat stores from before the marker was introduced.
+const storeMarkerName = ".convind-store"
+
+// storeVersion is the latest store version understood by this package.
+const storeVersion = 1
+
+type storeMarker struct {
+	Version int
+	Layout  FSLayout
+}
+
+// readStoreMarker reads the store marker in the given directory.
+// If there is no marker, the marker of a flat store is returned.
+func readStoreMarker(directory string) (storeMarker, error) {
+	marker := storeMarker{Version: storeVersion, Layout: FSLayoutFlat}
+	raw, err := os.ReadFile(filepath.Join(directory, storeMarkerName))
+	if errors.Is(err, os.ErrNotExist) {
+		return marker, nil
+	} else if err != nil {
+		return marker, err
+	}
+	err = json.Unmarshal(raw, &marker)
+	if err != nil {
+		return marker, fmt.Errorf("parse %s: %w", storeMarkerName, err)
+	}
+	if marker.Version > storeVersion {
+		return marker, fmt.Errorf("store version %d is newer than supported version %d", marker.Version, storeVersion)
+	}
+	if marker.Layout != FSLayoutFlat && marker.Layout != FSLayoutSharded {
+		return marker, fmt.Errorf("unknown layout %q", marker.Layout)
+	}
+	return marker, nil
+}
+
+func writeStoreMarker(directory string, layout FSLayout) error {
+	raw, err := json.Marshal(storeMarker{storeVersion, layout})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(directory, storeMarkerName), raw)
+}
+
+// OpenFSDataStore returns the FSDataStore in directory, and an error if its store marker is unreadable or from a newer version.
+func OpenFSDataStore(directory string) (*FSDataStore, error) {
+	marker, err := readStoreMarker(directory)
+	if err != nil {
+		return nil, err
+	}
+	return &FSDataStore{prefix: directory, layout: marker.Layout}, nil
+}
+
+// InitFSDataStore creates an empty store with the given layout in directory, which is created if needed.
+func InitFSDataStore(directory string, layout FSLayout) (*FSDataStore, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", directory)
+	}
+	err = writeStoreMarker(directory, layout)
+	if err != nil {
+		return nil, err
+	}
+	return &FSDataStore{prefix: directory, layout: layout}, nil
+}
+
+// Layout returns the layout new data is created in.
+func (f *FSDataStore) Layout() FSLayout {
+	return f.layout
+}
+
+func shardName(id ID) string {
+	return time.Unix(id.Epoch, 0).UTC().Format("2006-01")
+}
+
+// isShardName returns true if name is the name of a shard directory, as returned by [shardName].
+func isShardName(name string) bool {
+	_, err := time.Parse("2006-01", name)
+	return err == nil
+}
+
+// dataDir returns the directory of the data with the given ID in the given layout.
+func (f *FSDataStore) dataDir(id ID, layout FSLayout) string {
+	if layout == FSLayoutSharded {
+		return filepath.Join(f.prefix, shardName(id), id.String())
+	}
+	return filepath.Join(f.prefix, id.String())
+}
+
+// locate returns the directory of the data with the given ID.
+// Both layouts are tried, starting with the layout of the store, as a store can be in the middle of [FSDataStore.Relayout].
+func (f *FSDataStore) locate(id ID) (string, error) {
+	other := FSLayoutFlat
+	if f.layout == FSLayoutFlat {
+		other = FSLayoutSharded
+	}
+	dir := f.dataDir(id, f.layout)
+	_, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		_, err2 := os.Stat(f.dataDir(id, other))
+		if err2 == nil {
+			return f.dataDir(id, other), nil
+		}
+		return "", notExist(id)
+	} else if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Relayout changes the layout of the store, moves existing data into the new layout, and returns the number of data moved.
+// The store stays readable while (and if interrupted, after) moving, as both layouts are read.
+// Other FSDataStores of the same directory keep creating data in their layout until reopened.
+func (f *FSDataStore) Relayout(layout FSLayout) (int, error) {
+	if layout != FSLayoutFlat && layout != FSLayoutSharded {
+		return 0, fmt.Errorf("unknown layout %q", layout)
+	}
+	// written first, so that data created while moving goes to the new layout
+	err := writeStoreMarker(f.prefix, layout)
+	if err != nil {
+		return 0, err
+	}
+	f.layout = layout
+	ids, err := f.AllIDs()
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, id := range ids {
+		src, err := f.locate(id)
+		if err != nil {
+			return moved, err
+		}
+		dst := f.dataDir(id, layout)
+		if src == dst {
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(dst), 0700)
+		if err != nil {
+			return moved, err
+		}
+		err = os.Rename(src, dst)
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	if layout == FSLayoutFlat {
+		entries, err := os.ReadDir(f.prefix)
+		if err != nil {
+			return moved, err
+		}
+		for _, entry := range entries {
+			if isShardName(entry.Name()) {
+				// only removes empty directories
+				os.Remove(filepath.Join(f.prefix, entry.Name()))
+			}
+		}
+	}
+	return moved, syncDir(f.prefix)
+}
@@ -0,0 +1,404 @@
+package data
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryDataStore is a [DataStore] that keeps everything in memory, e.g. for tests and throwaway servers.
+// It is safe for concurrent use.
+//
+// The clock and ID generators can be replaced (before use) for deterministic results.
+type MemoryDataStore struct {
+	// Now returns the current time, and is used for creation and deletion times.
+	Now func() time.Time
+	// NewID returns the ID of new data.
+	NewID func() ID
+	// NewRevisionID returns the revision ID of new revisions.
+	NewRevisionID func() uint64
+
+	lock     sync.Mutex
+	data     map[ID]*memoryData
+	trash    map[ID]*memoryData
+	changes  []Change
+	watchers watchers
+}
+
+var (
+	_ Watcher   = (*MemoryDataStore)(nil)
+	_ ChangeLog = (*MemoryDataStore)(nil)
+)
+
+type memoryData struct {
+	mimeType     string
+	revisions    []*memoryRevision
+	deletionTime time.Time
+}
+
+type memoryRevision struct {
+	info     RevisionInfo
+	contents []byte
+	sha256   string
+	traits   map[string][]byte
+}
+
+// NewMemoryDataStore returns an empty MemoryDataStore using the real clock and random IDs.
+func NewMemoryDataStore() *MemoryDataStore {
+	return &MemoryDataStore{
+		Now:   time.Now,
+		NewID: GenerateRandomID,
+		NewRevisionID: func() uint64 {
+			return GenerateRandomID().Random
+		},
+		data:  map[ID]*memoryData{},
+		trash: map[ID]*memoryData{},
+	}
+}
+
+func (m *MemoryDataStore) GetDataByID(id ID) (Data, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	d, ok := m.data[id]
+	if !ok {
+		return nil, notExist(id)
+	}
+	return &MemoryData{store: m, id: id, mimeType: d.mimeType}, nil
+}
+
+func (m *MemoryDataStore) New(mimeType string) (Data, error) {
+	if mimeType == "" {
+		mimeType = DefaultMIMEType
+	}
+	id := m.NewID()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.data[id]; ok {
+		return nil, fmt.Errorf("data %s: %w", id, ErrExists)
+	}
+	m.data[id] = &memoryData{mimeType: mimeType}
+	m.record(Event{Kind: EventNew, ID: id, MIMEType: mimeType})
+	return &MemoryData{store: m, id: id, mimeType: mimeType}, nil
+}
+
+// AllIDs returns the IDs of all data, sorted.
+func (m *MemoryDataStore) AllIDs() ([]ID, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ids := make([]ID, 0, len(m.data))
+	for id := range m.data {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, compareIDs)
+	return ids, nil
+}
+
+func compareIDs(a, b ID) int {
+	if a.Epoch != b.Epoch {
+		return cmp.Compare(a.Epoch, b.Epoch)
+	}
+	return cmp.Compare(a.Random, b.Random)
+}
+
+func (m *MemoryDataStore) DeleteByID(id ID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	d, ok := m.data[id]
+	if !ok {
+		return notExist(id)
+	}
+	d.deletionTime = m.Now()
+	delete(m.data, id)
+	m.trash[id] = d
+	m.record(Event{Kind: EventDelete, ID: id})
+	return nil
+}
+
+func (m *MemoryDataStore) Trash() ([]TrashEntry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entries := make([]TrashEntry, 0, len(m.trash))
+	for id, d := range m.trash {
+		entries = append(entries, TrashEntry{id, d.mimeType, d.deletionTime})
+	}
+	slices.SortFunc(entries, func(a, b TrashEntry) int {
+		return b.DeletionTime.Compare(a.DeletionTime)
+	})
+	return entries, nil
+}
+
+func (m *MemoryDataStore) RestoreByID(id ID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	d, ok := m.trash[id]
+	if !ok {
+		return notExist(id)
+	}
+	if _, ok := m.data[id]; ok {
+		return fmt.Errorf("data %s: %w", id, ErrExists)
+	}
+	d.deletionTime = time.Time{}
+	delete(m.trash, id)
+	m.data[id] = d
+	m.record(Event{Kind: EventNew, ID: id, MIMEType: d.mimeType})
+	return nil
+}
+
+func (m *MemoryDataStore) PurgeByID(id ID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.trash[id]; !ok {
+		return notExist(id)
+	}
+	delete(m.trash, id)
+	m.record(Event{Kind: EventPurge, ID: id})
+	return nil
+}
+
+func (m *MemoryDataStore) ImportRevision(info RevisionInfo, r io.Reader) (DataRevision, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.trash[info.ID]; ok {
+		return nil, fmt.Errorf("data %s: %w", info.ID, ErrTrashed)
+	}
+	d, ok := m.data[info.ID]
+	if !ok {
+		mimeType := info.MIMEType
+		if mimeType == "" {
+			mimeType = DefaultMIMEType
+		}
+		d = &memoryData{mimeType: mimeType}
+		m.data[info.ID] = d
+		m.record(Event{Kind: EventNew, ID: info.ID, MIMEType: mimeType})
+	}
+	for _, revision := range d.revisions {
+		if revision.info.RevisionID == info.RevisionID {
+			return &MemoryRevision{m, revision}, nil
+		}
+	}
+	return m.addRevision(d, info, contents), nil
+}
+
+// addRevision adds a revision to d, and changes the MIME type of d to that of the revision if it is the latest.
+// The caller must hold m.lock.
+func (m *MemoryDataStore) addRevision(d *memoryData, info RevisionInfo, contents []byte) *MemoryRevision {
+	if info.CreationTime.IsZero() {
+		info.CreationTime = m.Now()
+	}
+	if info.MIMEType == "" {
+		info.MIMEType = d.mimeType
+	}
+	latest := !slices.ContainsFunc(d.revisions, func(r *memoryRevision) bool { return r.info.CreationTime.After(info.CreationTime) })
+	info.Parents = slices.Clone(info.Parents)
+	sum := sha256.Sum256(contents)
+	revision := &memoryRevision{
+		info:     info,
+		contents: contents,
+		sha256:   hex.EncodeToString(sum[:]),
+		traits:   map[string][]byte{},
+	}
+	d.revisions = append(d.revisions, revision)
+	m.record(Event{Kind: EventRevision, ID: info.ID, RevisionID: info.RevisionID})
+	if latest && info.MIMEType != d.mimeType {
+		d.mimeType = info.MIMEType
+		m.record(Event{Kind: EventMIMEType, ID: info.ID, MIMEType: info.MIMEType})
+	}
+	return &MemoryRevision{m, revision}
+}
+
+// record adds e to the change log, and sends it to watchers.
+// The caller must hold m.lock.
+func (m *MemoryDataStore) record(e Event) {
+	m.changes = append(m.changes, Change{uint64(len(m.changes)) + 1, e})
+	m.watchers.emit(e)
+}
+
+// Seq returns the sequence number of the latest change, which is the number of changes.
+func (m *MemoryDataStore) Seq() (uint64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return uint64(len(m.changes)), nil
+}
+
+func (m *MemoryDataStore) Changes(since uint64) ([]Change, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if since >= uint64(len(m.changes)) {
+		return []Change{}, nil
+	}
+	return slices.Clone(m.changes[since:]), nil
+}
+
+// Watch returns a channel of events for changes made after Watch returns, which is closed after ctx is done.
+func (m *MemoryDataStore) Watch(ctx context.Context) (<-chan Event, error) {
+	return m.watchers.watch(ctx, nil), nil
+}
+
+// MemoryData is a [Data] in a [MemoryDataStore].
+type MemoryData struct {
+	store *MemoryDataStore
+	id    ID
+	// lock guards mimeType, which changes when a revision with another MIME type is added through this handle.
+	lock     sync.Mutex
+	mimeType string
+}
+
+var _ Data = (*MemoryData)(nil)
+
+func (d *MemoryData) ID() ID {
+	return d.id
+}
+
+// Revisions returns all revisions, sorted newest to oldest.
+func (d *MemoryData) Revisions() ([]DataRevision, error) {
+	d.store.lock.Lock()
+	defer d.store.lock.Unlock()
+	md, ok := d.store.data[d.id]
+	if !ok {
+		return nil, notExist(d.id)
+	}
+	revisions := make([]DataRevision, len(md.revisions))
+	for i, revision := range md.revisions {
+		revisions[i] = &MemoryRevision{d.store, revision}
+	}
+	slices.SortStableFunc(revisions, func(a, b DataRevision) int {
+		return b.CreationTime().Compare(a.CreationTime())
+	})
+	return revisions, nil
+}
+
+func (d *MemoryData) NewRevision(r io.Reader, opts RevisionOptions) (DataRevision, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	revisionID := d.store.NewRevisionID()
+	d.store.lock.Lock()
+	defer d.store.lock.Unlock()
+	md, ok := d.store.data[d.id]
+	if !ok {
+		return nil, notExist(d.id)
+	}
+	dr := d.store.addRevision(md, RevisionInfo{
+		ID:         d.id,
+		RevisionID: revisionID,
+		MIMEType:   opts.MIMEType,
+		Author:     opts.Author,
+		Parents:    opts.Parents,
+	}, contents)
+	d.lock.Lock()
+	d.mimeType = md.mimeType
+	d.lock.Unlock()
+	return dr, nil
+}
+
+func (d *MemoryData) MIMEType() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.mimeType
+}
+
+func (d *MemoryData) MarshalJSON() ([]byte, error) {
+	return MarshalData(d)
+}
+
+// MemoryRevision is a [DataRevision] in a [MemoryDataStore].
+type MemoryRevision struct {
+	store    *MemoryDataStore
+	revision *memoryRevision
+}
+
+var _ DataRevision = (*MemoryRevision)(nil)
+
+func (r *MemoryRevision) Data() Data {
+	r.store.lock.Lock()
+	defer r.store.lock.Unlock()
+	id := r.revision.info.ID
+	mimeType := r.revision.info.MIMEType
+	if d, ok := r.store.data[id]; ok {
+		mimeType = d.mimeType
+	} else if d, ok := r.store.trash[id]; ok {
+		mimeType = d.mimeType
+	}
+	return &MemoryData{store: r.store, id: id, mimeType: mimeType}
+}
+
+func (r *MemoryRevision) RevisionID() uint64 {
+	return r.revision.info.RevisionID
+}
+
+func (r *MemoryRevision) CreationTime() time.Time {
+	return r.revision.info.CreationTime
+}
+
+func (r *MemoryRevision) Author() string {
+	return r.revision.info.Author
+}
+
+func (r *MemoryRevision) Parents() []uint64 {
+	return r.revision.info.Parents
+}
+
+func (r *MemoryRevision) MIMEType() string {
+	return r.revision.info.MIMEType
+}
+
+func (r *MemoryRevision) NewReadCloser() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(r.revision.contents)), nil
+}
+
+func (r *MemoryRevision) SHA256() (string, error) {
+	return r.revision.sha256, nil
+}
+
+func (r *MemoryRevision) Traits() Traits {
+	return &memoryTraits{r.store, r.revision}
+}
+
+type memoryTraits struct {
+	store    *MemoryDataStore
+	revision *memoryRevision
+}
+
+func (t *memoryTraits) List() ([]string, error) {
+	t.store.lock.Lock()
+	defer t.store.lock.Unlock()
+	names := make([]string, 0, len(t.revision.traits))
+	for name := range t.revision.traits {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (t *memoryTraits) Get(name string) (io.ReadCloser, error) {
+	t.store.lock.Lock()
+	defer t.store.lock.Unlock()
+	b, ok := t.revision.traits[name]
+	if !ok {
+		return nil, ErrNoSuchTrait
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (t *memoryTraits) Put(name string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	t.store.lock.Lock()
+	defer t.store.lock.Unlock()
+	t.revision.traits[name] = b
+	return nil
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryDataStore(t *testing.T) {
+	store := NewMemoryDataStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	var n uint64
+	store.NewID = func() ID {
+		n++
+		return ID{1, n}
+	}
+	store.NewRevisionID = func() uint64 {
+		n++
+		return n
+	}
+
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID() != (ID{1, 1}) {
+		t.Fatalf("ID = %v", d.ID())
+	}
+	first, err := d.NewRevision(strings.NewReader("first"), RevisionOptions{Author: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.NewRevision(strings.NewReader("second"), RevisionOptions{Parents: []uint64{first.RevisionID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RevisionID() != 2 || second.RevisionID() != 3 {
+		t.Fatalf("revision IDs = %d, %d", first.RevisionID(), second.RevisionID())
+	}
+	if !second.CreationTime().Equal(time.Date(2025, 1, 1, 0, 0, 2, 0, time.UTC)) {
+		t.Fatalf("CreationTime = %s", second.CreationTime())
+	}
+	revisions, err := d.Revisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].RevisionID() != second.RevisionID() {
+		t.Fatalf("Revisions not newest first: %v", revisions)
+	}
+	latest, err := LatestRevision(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := latest.NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "second" {
+		t.Fatalf("latest = %q", b)
+	}
+
+	err = first.Traits().Put("example.com/caption", strings.NewReader("caption"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = second.Traits().Get("example.com/caption")
+	if !errors.Is(err, ErrNoSuchTrait) {
+		t.Fatalf("traits are per revision: %v", err)
+	}
+
+	err = store.DeleteByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GetDataByID(d.ID())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("GetDataByID of trashed data: %v", err)
+	}
+	trash, err := store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || !trash[0].DeletionTime.Equal(time.Date(2025, 1, 1, 0, 0, 3, 0, time.UTC)) {
+		t.Fatalf("Trash = %v", trash)
+	}
+	err = store.RestoreByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := store.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("AllIDs after restore = %v", ids)
+	}
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// MigrateMetadata fills in missing revision metadata, and returns the number of revisions migrated.
+// Revisions created before metadata was stored get:
+//   - their creation time from the modification time of the revision file,
+//   - the MIME type of the data, and
+//   - their contents moved into a content-addressed blob.
+//
+// Zero-length revisions without a content hash are left in place, so that [FSDataStore.Check] can still report them.
+func (f *FSDataStore) MigrateMetadata() (int, error) {
+	ids, err := f.AllIDs()
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, id := range ids {
+		d, err := f.GetDataByID(id)
+		if err != nil {
+			return migrated, err
+		}
+		revisions, err := d.Revisions()
+		if err != nil {
+			return migrated, err
+		}
+		for _, revision := range revisions {
+			ok, err := d.(*FSData).migrateRevision(revision.(*FSRevision))
+			if err != nil {
+				return migrated, fmt.Errorf("migrate %s/%d: %w", id, revision.RevisionID(), err)
+			}
+			if ok {
+				migrated++
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// migrateRevision fills in missing metadata of r, and returns true if anything changed.
+func (f *FSData) migrateRevision(r *FSRevision) (bool, error) {
+	meta := r.meta
+	if meta.CreationTime.IsZero() {
+		meta.CreationTime = r.info.ModTime()
+	}
+	if meta.MIMEType == "" {
+		meta.MIMEType = f.MIMEType()
+	}
+	path := filepath.Join(f.dir, strconv.FormatUint(r.revisionID, 10))
+	legacyContents := meta.SHA256 == "" && r.info.Size() > 0
+	if legacyContents {
+		file, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		meta.SHA256, err = writeBlob(f.prefix, file)
+		file.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	if meta.CreationTime.Equal(r.meta.CreationTime) && meta.MIMEType == r.meta.MIMEType && meta.SHA256 == r.meta.SHA256 {
+		return false, nil
+	}
+	err := f.writeRevisionMeta(r.revisionID, meta)
+	if err != nil {
+		return false, err
+	}
+	if legacyContents {
+		// the contents are now read from the blob, so the revision file only marks the revision's existence
+		err = os.Truncate(path, 0)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"io"
+	"strings"
+)
+
+// Open returns the data store described by spec, which is one of:
+//   - "mem:" for an empty [MemoryDataStore], whose contents are lost on exit
+//   - "bolt:" followed by the path to the database file of a [BoltDataStore]
+//   - the path to the root of a [FSDataStore]
+//
+// The returned store should be closed with [Close] when done.
+func Open(spec string) (DataStore, error) {
+	if spec == "mem:" {
+		return NewMemoryDataStore(), nil
+	}
+	if path, ok := strings.CutPrefix(spec, "bolt:"); ok {
+		return OpenBoltDataStore(path)
+	}
+	return OpenFSDataStore(spec)
+}
+
+// Close closes s if it holds resources (e.g. an open database file), and does nothing otherwise.
+func Close(s DataStore) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
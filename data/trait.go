@@ -0,0 +1,90 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// FSTraits stores traits of a revision in a directory next to the revision.
+// Each trait is a file, named by the base64-encoded trait name.
+type FSTraits struct {
+	dir string
+}
+
+var _ Traits = (*FSTraits)(nil)
+
+func (f *FSRevision) Traits() Traits {
+	return &FSTraits{filepath.Join(f.dir, ".traits", strconv.FormatUint(f.revisionID, 10))}
+}
+
+func traitFilename(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func (t *FSTraits) List() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name()[0] == '.' {
+			continue
+		}
+		name, err := base64.RawURLEncoding.DecodeString(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("decode trait name %s: %w", entry.Name(), err)
+		}
+		names = append(names, string(name))
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (t *FSTraits) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(t.dir, traitFilename(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSuchTrait
+	}
+	return f, err
+}
+
+func (t *FSTraits) Put(name string, r io.Reader) error {
+	err := os.MkdirAll(t.dir, 0700)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so that readers never see a partially written trait
+	tmp, err := os.CreateTemp(t.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), filepath.Join(t.dir, traitFilename(name)))
+	if err != nil {
+		return err
+	}
+	return syncDir(t.dir)
+}
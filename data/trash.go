@@ -0,0 +1,123 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Trashed data is moved into the .trash directory of the store.
+// Each trashed data directory has a .deleted file with the deletion time.
+
+func (f *FSDataStore) trashPath(id ID) string {
+	return filepath.Join(f.prefix, ".trash", id.String())
+}
+
+func (f *FSDataStore) DeleteByID(id ID) error {
+	dir, err := f.locate(id)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Join(f.prefix, ".trash"), 0700)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(dir, ".deleted"), []byte(time.Now().Format(time.RFC3339Nano)))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(dir, f.trashPath(id))
+	if err != nil {
+		os.Remove(filepath.Join(dir, ".deleted"))
+		return err
+	}
+	return appendChange(f.prefix, Event{Kind: EventDelete, ID: id})
+}
+
+func (f *FSDataStore) Trash() ([]TrashEntry, error) {
+	entries, err := os.ReadDir(filepath.Join(f.prefix, ".trash"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []TrashEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	result := make([]TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name()[0] == '.' {
+			continue
+		}
+		id, err := ParseID(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		raw, err := os.ReadFile(filepath.Join(f.trashPath(id), ".deleted"))
+		if err != nil {
+			return nil, fmt.Errorf("reading .deleted: %w", err)
+		}
+		deletionTime, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("parsing .deleted: %w", err)
+		}
+		mimeType, err := os.ReadFile(filepath.Join(f.trashPath(id), ".datatype"))
+		if errors.Is(err, os.ErrNotExist) {
+			mimeType = []byte(DefaultMIMEType)
+		} else if err != nil {
+			return nil, fmt.Errorf("reading .datatype: %w", err)
+		}
+		result = append(result, TrashEntry{id, strings.TrimSpace(string(mimeType)), deletionTime})
+	}
+	slices.SortFunc(result, func(a, b TrashEntry) int {
+		return b.DeletionTime.Compare(a.DeletionTime)
+	})
+	return result, nil
+}
+
+// RestoreByID moves data out of the trash, into the current layout of the store.
+func (f *FSDataStore) RestoreByID(id ID) error {
+	_, err := f.locate(id)
+	if err == nil {
+		return fmt.Errorf("data %s: %w", id, ErrExists)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	_, err = os.Stat(f.trashPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return notExist(id)
+	} else if err != nil {
+		return err
+	}
+	dir := f.dataDir(id, f.layout)
+	err = os.MkdirAll(filepath.Dir(dir), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(f.trashPath(id), dir)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, ".deleted"))
+	if err != nil {
+		return err
+	}
+	return appendChange(f.prefix, Event{Kind: EventNew, ID: id, MIMEType: readMIMEType(dir)})
+}
+
+// PurgeByID permanently deletes trashed data.
+// Blobs are shared between revisions, so blobs of purged revisions are left behind; use [FSDataStore.Check] with [CheckOptions.Repair] to delete unreferenced blobs.
+func (f *FSDataStore) PurgeByID(id ID) error {
+	_, err := os.Stat(f.trashPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return notExist(id)
+	} else if err != nil {
+		return err
+	}
+	err = os.RemoveAll(f.trashPath(id))
+	if err != nil {
+		return err
+	}
+	return appendChange(f.prefix, Event{Kind: EventPurge, ID: id})
+}
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of change an [Event] describes.
+type EventKind string
+
+const (
+	// EventNew is sent when data is created, or restored from the trash.
+	// Revisions the data already has (e.g. when restored) may be sent as [EventRevision] afterwards.
+	EventNew EventKind = "new"
+	// EventRevision is sent when a revision is added to data.
+	EventRevision EventKind = "revision"
+	// EventDelete is sent when data is moved into the trash.
+	EventDelete EventKind = "delete"
+	// EventMIMEType is sent when the MIME type of data changes.
+	EventMIMEType EventKind = "mime-type"
+	// EventPurge is sent when trashed data is permanently deleted.
+	// Directory stores only record it in their change log, as the trash is not watched.
+	EventPurge EventKind = "purge"
+)
+
+// Event describes a change to a [DataStore].
+type Event struct {
+	Kind EventKind
+	ID   ID
+	// RevisionID is the ID of the new revision, for [EventRevision].
+	RevisionID uint64
+	// MIMEType is the MIME type of the data, for [EventNew] and [EventMIMEType].
+	MIMEType string
+}
+
+// Watcher is implemented by [DataStore]s that can report changes as they happen.
+// Callers should use [Watch], which also works with other DataStores.
+type Watcher interface {
+	DataStore
+	// Watch returns a channel of events for changes made after Watch returns, which is closed after ctx is done.
+	// Events are queued (not dropped) while the receiver is busy, but the same event may be sent more than once.
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// DefaultPollInterval is how often [Watch] polls DataStores that don't implement [Watcher].
+const DefaultPollInterval = 10 * time.Second
+
+// Watch returns a channel of events for changes to s, which is closed after ctx is done.
+// If s doesn't implement [Watcher], s is polled every [DefaultPollInterval] (see [PollWatch]).
+func Watch(ctx context.Context, s DataStore) (<-chan Event, error) {
+	if s, ok := s.(Watcher); ok {
+		return s.Watch(ctx)
+	}
+	return PollWatch(ctx, s, DefaultPollInterval)
+}
+
+// PollWatch reports changes to s by listing all data and revisions every interval, and comparing the listing to the previous one.
+// Changes between polls are coalesced (e.g. data created and deleted between polls is not reported at all).
+// If listing fails, the poll is skipped and retried after the next interval.
+func PollWatch(ctx context.Context, s DataStore, interval time.Duration) (<-chan Event, error) {
+	prev, err := pollSnapshot(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, err := pollSnapshot(ctx, s)
+			if err != nil {
+				continue
+			}
+			for _, e := range diffSnapshots(prev, next) {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			prev = next
+		}
+	}()
+	return ch, nil
+}
+
+type polledData struct {
+	mimeType  string
+	revisions []uint64
+}
+
+func pollSnapshot(ctx context.Context, s DataStore) (map[ID]polledData, error) {
+	ids, err := AllIDsContext(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[ID]polledData, len(ids))
+	for _, id := range ids {
+		d, err := GetDataByIDContext(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := d.Revisions()
+		if err != nil {
+			return nil, err
+		}
+		p := polledData{d.MIMEType(), make([]uint64, len(revisions))}
+		// oldest first, so that events are in creation order
+		for i, revision := range revisions {
+			p.revisions[len(revisions)-1-i] = revision.RevisionID()
+		}
+		snapshot[id] = p
+	}
+	return snapshot, nil
+}
+
+func diffSnapshots(prev, next map[ID]polledData) []Event {
+	events := make([]Event, 0)
+	for id, n := range next {
+		p, ok := prev[id]
+		if !ok {
+			events = append(events, Event{Kind: EventNew, ID: id, MIMEType: n.mimeType})
+		} else if p.mimeType != n.mimeType {
+			events = append(events, Event{Kind: EventMIMEType, ID: id, MIMEType: n.mimeType})
+		}
+		known := map[uint64]bool{}
+		for _, revisionID := range p.revisions {
+			known[revisionID] = true
+		}
+		for _, revisionID := range n.revisions {
+			if !known[revisionID] {
+				events = append(events, Event{Kind: EventRevision, ID: id, RevisionID: revisionID})
+			}
+		}
+	}
+	for id := range prev {
+		if _, ok := next[id]; !ok {
+			events = append(events, Event{Kind: EventDelete, ID: id})
+		}
+	}
+	return events
+}
+
+// watchers sends events to the channels returned by Watch, for DataStores that know about all changes themselves.
+// The zero value has no watchers.
+type watchers struct {
+	lock     sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	lock  sync.Mutex
+	queue []Event
+	// wake has a value when queue might be non-empty
+	wake chan struct{}
+}
+
+// watch returns a channel receiving events passed to emit, until ctx is done.
+// stop, if not nil, is called (without holding any locks) after the last watcher is removed.
+func (w *watchers) watch(ctx context.Context, stop func()) <-chan Event {
+	wr := &watcher{wake: make(chan struct{}, 1)}
+	w.lock.Lock()
+	if w.watchers == nil {
+		w.watchers = map[*watcher]struct{}{}
+	}
+	w.watchers[wr] = struct{}{}
+	w.lock.Unlock()
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		defer func() {
+			w.lock.Lock()
+			delete(w.watchers, wr)
+			n := len(w.watchers)
+			w.lock.Unlock()
+			if n == 0 && stop != nil {
+				stop()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wr.wake:
+			}
+			wr.lock.Lock()
+			queue := wr.queue
+			wr.queue = nil
+			wr.lock.Unlock()
+			for _, e := range queue {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// len returns the number of watchers.
+func (w *watchers) len() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.watchers)
+}
+
+// emit queues events for all watchers, without blocking on receivers.
+func (w *watchers) emit(events ...Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for wr := range w.watchers {
+		wr.lock.Lock()
+		wr.queue = append(wr.queue, events...)
+		wr.lock.Unlock()
+		select {
+		case wr.wake <- struct{}{}:
+		default:
+		}
+	}
+}
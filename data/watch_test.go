@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollWatch(t *testing.T) {
+	store := NewMemoryDataStore()
+	kept, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := PollWatch(ctx, store, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := store.New("text/markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("x"), RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteByID(kept.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[Event]bool{
+		{Kind: EventNew, ID: d.ID(), MIMEType: "text/markdown"}:        true,
+		{Kind: EventRevision, ID: d.ID(), RevisionID: dr.RevisionID()}: true,
+		{Kind: EventDelete, ID: kept.ID()}:                             true,
+	}
+	for len(want) > 0 {
+		select {
+		case e := <-events:
+			if !want[e] {
+				t.Fatalf("unexpected event %+v", e)
+			}
+			delete(want, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+}
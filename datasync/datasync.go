@@ -0,0 +1,345 @@
+// Package datasync synchronizes revisions between data stores.
+//
+// Revisions are immutable and identified by their (ID, revision ID) pair, so synchronizing two stores is a matter of copying each revision that is missing on one side.
+// Data without any revisions is not synchronized.
+// Concurrent edits made on both sides end up as multiple heads of the same data, which can then be merged (see [inaba.kiyuri.ca/2025/convind/merge]).
+package datasync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// Entry identifies a revision.
+type Entry struct {
+	ID         data.ID
+	RevisionID uint64
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s/%d", e.ID, e.RevisionID)
+}
+
+// Peer is one side of a synchronization.
+type Peer interface {
+	// Entries returns all revisions in this peer.
+	Entries() ([]Entry, error)
+	// Open returns the metadata and contents of a revision.
+	Open(Entry) (data.RevisionInfo, io.ReadCloser, error)
+	// Import stores a revision from another peer.
+	Import(info data.RevisionInfo, r io.Reader) error
+	// TraitEntries returns all traits in this peer.
+	TraitEntries() ([]TraitEntry, error)
+	// OpenTrait returns the contents of a trait.
+	OpenTrait(TraitEntry) (io.ReadCloser, error)
+	// PutTrait stores a trait from another peer.
+	PutTrait(TraitEntry, io.Reader) error
+}
+
+// TraitEntry identifies a trait of a revision.
+type TraitEntry struct {
+	Entry
+	Name string
+}
+
+func (e TraitEntry) String() string {
+	return e.Entry.String() + "/" + e.Name
+}
+
+// Stats counts the revisions copied by [Sync].
+type Stats struct {
+	// AToB is the number of revisions copied from a to b.
+	AToB int
+	// BToA is the number of revisions copied from b to a.
+	BToA int
+	// TraitsAToB is the number of traits copied from a to b.
+	TraitsAToB int
+	// TraitsBToA is the number of traits copied from b to a.
+	TraitsBToA int
+	// SkippedAToB is the number of revisions (and their traits) not copied from a to b, as their data is in the trash of b.
+	SkippedAToB int
+	// SkippedBToA is the number of revisions (and their traits) not copied from b to a, as their data is in the trash of a.
+	SkippedBToA int
+}
+
+// Sync copies revisions missing in b from a, and revisions missing in a from b.
+// Then, traits are copied the same way.
+// Traits that exist on both sides are left as-is, even if they differ, as traits are derived from the revision and thus should be equivalent.
+func Sync(a, b Peer) (Stats, error) {
+	var stats Stats
+	aEntries, err := a.Entries()
+	if err != nil {
+		return stats, fmt.Errorf("list a: %w", err)
+	}
+	bEntries, err := b.Entries()
+	if err != nil {
+		return stats, fmt.Errorf("list b: %w", err)
+	}
+	var trashedInB, trashedInA map[data.ID]bool
+	stats.AToB, stats.SkippedAToB, trashedInB, err = copyMissing(a, b, missing(aEntries, bEntries))
+	if err != nil {
+		return stats, fmt.Errorf("a to b: %w", err)
+	}
+	stats.BToA, stats.SkippedBToA, trashedInA, err = copyMissing(b, a, missing(bEntries, aEntries))
+	if err != nil {
+		return stats, fmt.Errorf("b to a: %w", err)
+	}
+
+	aTraits, err := a.TraitEntries()
+	if err != nil {
+		return stats, fmt.Errorf("list traits of a: %w", err)
+	}
+	bTraits, err := b.TraitEntries()
+	if err != nil {
+		return stats, fmt.Errorf("list traits of b: %w", err)
+	}
+	stats.TraitsAToB, err = copyMissingTraits(a, b, missing(aTraits, bTraits), trashedInB)
+	if err != nil {
+		return stats, fmt.Errorf("traits a to b: %w", err)
+	}
+	stats.TraitsBToA, err = copyMissingTraits(b, a, missing(bTraits, aTraits), trashedInA)
+	if err != nil {
+		return stats, fmt.Errorf("traits b to a: %w", err)
+	}
+	return stats, nil
+}
+
+// Copy copies revisions and then traits missing in dst from src, and returns the stats with only AToB and TraitsAToB set.
+// Unlike [Sync], nothing is copied from dst to src.
+func Copy(src, dst Peer) (Stats, error) {
+	var stats Stats
+	srcEntries, err := src.Entries()
+	if err != nil {
+		return stats, fmt.Errorf("list src: %w", err)
+	}
+	dstEntries, err := dst.Entries()
+	if err != nil {
+		return stats, fmt.Errorf("list dst: %w", err)
+	}
+	var trashed map[data.ID]bool
+	stats.AToB, stats.SkippedAToB, trashed, err = copyMissing(src, dst, missing(srcEntries, dstEntries))
+	if err != nil {
+		return stats, err
+	}
+	srcTraits, err := src.TraitEntries()
+	if err != nil {
+		return stats, fmt.Errorf("list traits of src: %w", err)
+	}
+	dstTraits, err := dst.TraitEntries()
+	if err != nil {
+		return stats, fmt.Errorf("list traits of dst: %w", err)
+	}
+	stats.TraitsAToB, err = copyMissingTraits(src, dst, missing(srcTraits, dstTraits), trashed)
+	return stats, err
+}
+
+// missing returns the entries in src that are not in dst.
+func missing[E interface {
+	comparable
+	fmt.Stringer
+}](src, dst []E) []E {
+	have := make(map[E]bool, len(dst))
+	for _, e := range dst {
+		have[e] = true
+	}
+	result := make([]E, 0)
+	for _, e := range src {
+		if !have[e] {
+			result = append(result, e)
+		}
+	}
+	// sorted for reproducible ordering in logs
+	slices.SortFunc(result, func(a, b E) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return result
+}
+
+// copyMissing copies entries from src to dst, and returns the number of revisions copied, and skipped as their data is in the trash of dst.
+// Trashed data (as returned) is skipped instead of failing the whole copy, as it was deleted on purpose.
+func copyMissing(src, dst Peer, entries []Entry) (copied, skipped int, trashed map[data.ID]bool, err error) {
+	trashed = map[data.ID]bool{}
+	for _, e := range entries {
+		if trashed[e.ID] {
+			skipped++
+			continue
+		}
+		err = copyEntry(src, dst, e)
+		if errors.Is(err, data.ErrTrashed) {
+			trashed[e.ID] = true
+			skipped++
+			continue
+		} else if err != nil {
+			return copied, skipped, trashed, fmt.Errorf("copy %s: %w", e, err)
+		}
+		copied++
+	}
+	return copied, skipped, trashed, nil
+}
+
+func copyEntry(src, dst Peer, e Entry) error {
+	info, rc, err := src.Open(e)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.Import(info, rc)
+}
+
+// copyMissingTraits copies entries from src to dst, except for traits of data in trashed (which have no revision to put them on), and returns the number of traits copied.
+func copyMissingTraits(src, dst Peer, entries []TraitEntry, trashed map[data.ID]bool) (int, error) {
+	copied := 0
+	for _, e := range entries {
+		if trashed[e.ID] {
+			continue
+		}
+		err := copyTrait(src, dst, e)
+		if err != nil {
+			return copied, fmt.Errorf("copy %s: %w", e, err)
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+func copyTrait(src, dst Peer, e TraitEntry) error {
+	rc, err := src.OpenTrait(e)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.PutTrait(e, rc)
+}
+
+// StorePeer returns a [Peer] backed by a [data.DataStore].
+func StorePeer(s data.DataStore) Peer {
+	return &storePeer{s}
+}
+
+type storePeer struct {
+	s data.DataStore
+}
+
+func (p *storePeer) Entries() ([]Entry, error) {
+	return Entries(p.s)
+}
+
+func (p *storePeer) Open(e Entry) (data.RevisionInfo, io.ReadCloser, error) {
+	dr, err := p.revision(e)
+	if err != nil {
+		return data.RevisionInfo{}, nil, err
+	}
+	rc, err := dr.NewReadCloser()
+	if err != nil {
+		return data.RevisionInfo{}, nil, err
+	}
+	return data.GetRevisionInfo(dr), rc, nil
+}
+
+func (p *storePeer) Import(info data.RevisionInfo, r io.Reader) error {
+	_, err := p.s.ImportRevision(info, r)
+	return err
+}
+
+func (p *storePeer) TraitEntries() ([]TraitEntry, error) {
+	return TraitEntries(p.s)
+}
+
+func (p *storePeer) revision(e Entry) (data.DataRevision, error) {
+	d, err := p.s.GetDataByID(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := data.FindRevision(d, e.RevisionID)
+	if err != nil {
+		return nil, err
+	}
+	if dr == nil {
+		return nil, fmt.Errorf("revision %s not found", e)
+	}
+	return dr, nil
+}
+
+func (p *storePeer) OpenTrait(e TraitEntry) (io.ReadCloser, error) {
+	dr, err := p.revision(e.Entry)
+	if err != nil {
+		return nil, err
+	}
+	return dr.Traits().Get(e.Name)
+}
+
+func (p *storePeer) PutTrait(e TraitEntry, r io.Reader) error {
+	dr, err := p.revision(e.Entry)
+	if err != nil {
+		return err
+	}
+	return dr.Traits().Put(e.Name, r)
+}
+
+// Entries returns all revisions in s.
+func Entries(s data.DataStore) ([]Entry, error) {
+	return EntriesContext(context.Background(), s)
+}
+
+// EntriesContext is [Entries], but stops when ctx is done.
+func EntriesContext(ctx context.Context, s data.DataStore) ([]Entry, error) {
+	ids, err := data.AllIDsContext(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		d, err := data.GetDataByIDContext(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := d.Revisions()
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions {
+			entries = append(entries, Entry{id, revision.RevisionID()})
+		}
+	}
+	return entries, nil
+}
+
+// TraitEntries returns all traits of all revisions in s.
+func TraitEntries(s data.DataStore) ([]TraitEntry, error) {
+	return TraitEntriesContext(context.Background(), s)
+}
+
+// TraitEntriesContext is [TraitEntries], but stops when ctx is done.
+func TraitEntriesContext(ctx context.Context, s data.DataStore) ([]TraitEntry, error) {
+	ids, err := data.AllIDsContext(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TraitEntry, 0)
+	for _, id := range ids {
+		d, err := data.GetDataByIDContext(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := d.Revisions()
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions {
+			names, err := revision.Traits().List()
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				entries = append(entries, TraitEntry{Entry{id, revision.RevisionID()}, name})
+			}
+		}
+	}
+	return entries, nil
+}
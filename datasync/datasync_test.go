@@ -0,0 +1,211 @@
+package datasync_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/datasync"
+	"inaba.kiyuri.ca/2025/convind/wiki/server"
+)
+
+func TestSyncStores(t *testing.T) {
+	a := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	b := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	testSync(t, a, datasync.StorePeer(a), b, datasync.StorePeer(b))
+}
+
+func TestSyncHTTP(t *testing.T) {
+	a := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	b := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	s, err := server.New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	testSync(t, a, datasync.StorePeer(a), b, datasync.HTTPPeer(ts.URL, ts.Client()))
+}
+
+func TestCopyToBolt(t *testing.T) {
+	src := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	dst, err := data.OpenBoltDataStore(filepath.Join(t.TempDir(), "convind.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	d, err := src.New("text/markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("# a"), data.RevisionOptions{Author: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dr.Traits().Put("example.com/caption", strings.NewReader("caption"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onlyDst, err := dst.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = onlyDst.NewRevision(strings.NewReader("not copied back"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := datasync.Copy(datasync.StorePeer(src), datasync.StorePeer(dst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datasync.Stats{AToB: 1, TraitsAToB: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	ids, err := src.AllIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("copied back to src: %v", ids)
+	}
+	d2, err := dst.GetDataByID(d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr2, err := data.FindRevision(d2, dr.RevisionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dr2 == nil || dr2.Author() != "a" || !dr2.CreationTime().Equal(dr.CreationTime()) {
+		t.Fatalf("revision not copied as-is: %v", dr2)
+	}
+}
+
+func testSync(t *testing.T, a data.DataStore, aPeer datasync.Peer, b data.DataStore, bPeer datasync.Peer) {
+	onlyA, err := a.New("text/markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := onlyA.NewRevision(strings.NewReader("# a"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := onlyA.NewRevision(strings.NewReader("# a2"), data.RevisionOptions{Parents: []uint64{first.RevisionID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = second.Traits().Put("example.com/caption", strings.NewReader("caption"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onlyB, err := b.New("image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = onlyB.NewRevision(strings.NewReader("png"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := datasync.Sync(aPeer, bPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datasync.Stats{AToB: 2, BToA: 1, TraitsAToB: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	stats, err = datasync.Sync(aPeer, bPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datasync.Stats{}) {
+		t.Fatalf("second sync copied revisions: %+v", stats)
+	}
+
+	d, err := b.GetDataByID(onlyA.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MIMEType() != "text/markdown" {
+		t.Fatalf("MIME type = %s", d.MIMEType())
+	}
+	dr, err := data.FindRevision(d, second.RevisionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dr == nil {
+		t.Fatal("revision not copied")
+	}
+	if !dr.CreationTime().Truncate(time.Millisecond).Equal(second.CreationTime().Truncate(time.Millisecond)) {
+		t.Fatalf("creation time = %s, want %s", dr.CreationTime(), second.CreationTime())
+	}
+	if !slices.Equal(dr.Parents(), []uint64{first.RevisionID()}) {
+		t.Fatalf("parents = %v", dr.Parents())
+	}
+	rc, err := dr.NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "# a2" {
+		t.Fatalf("content = %q", content)
+	}
+
+	names, err := dr.Traits().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"example.com/caption"}) {
+		t.Fatalf("traits = %v", names)
+	}
+
+	d, err = a.GetDataByID(onlyB.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MIMEType() != "image/png" {
+		t.Fatalf("MIME type = %s", d.MIMEType())
+	}
+
+	// revisions of data trashed on the other side are skipped, with their traits
+	third, err := onlyA.NewRevision(strings.NewReader("# a3"), data.RevisionOptions{Parents: []uint64{second.RevisionID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = third.Traits().Put("example.com/caption", strings.NewReader("caption 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.DeleteByID(onlyA.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err = datasync.Sync(aPeer, bPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datasync.Stats{SkippedAToB: 3}) {
+		t.Fatalf("stats with trashed data = %+v", stats)
+	}
+	err = b.RestoreByID(onlyA.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err = datasync.Sync(aPeer, bPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datasync.Stats{AToB: 1, TraitsAToB: 1}) {
+		t.Fatalf("stats after restoring = %+v", stats)
+	}
+}
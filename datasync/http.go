@@ -0,0 +1,183 @@
+package datasync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// Headers used to transfer revision metadata over HTTP.
+// The MIME type is transferred using the Content-Type header.
+const (
+	HeaderCreationTime = "Creation-Time"
+	HeaderAuthor       = "Author"
+	HeaderParents      = "Parent-Revision-IDs"
+)
+
+// SetRevisionHeaders sets the headers describing info.
+func SetRevisionHeaders(h http.Header, info data.RevisionInfo) {
+	h.Set("Content-Type", info.MIMEType)
+	h.Set(HeaderCreationTime, info.CreationTime.Format(time.RFC3339Nano))
+	h.Set(HeaderAuthor, info.Author)
+	parents := make([]string, len(info.Parents))
+	for i, parent := range info.Parents {
+		parents[i] = strconv.FormatUint(parent, 10)
+	}
+	h.Set(HeaderParents, strings.Join(parents, ","))
+}
+
+// ParseRevisionHeaders fills in the fields of info described by headers set by [SetRevisionHeaders].
+// The ID and revision ID are not part of the headers, and are left as-is.
+func ParseRevisionHeaders(h http.Header, info *data.RevisionInfo) error {
+	info.MIMEType = h.Get("Content-Type")
+	creationTime, err := time.Parse(time.RFC3339Nano, h.Get(HeaderCreationTime))
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", HeaderCreationTime, err)
+	}
+	info.CreationTime = creationTime
+	info.Author = h.Get(HeaderAuthor)
+	info.Parents = nil
+	if parentsRaw := h.Get(HeaderParents); parentsRaw != "" {
+		for _, parentRaw := range strings.Split(parentsRaw, ",") {
+			parent, err := strconv.ParseUint(parentRaw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", HeaderParents, err)
+			}
+			info.Parents = append(info.Parents, parent)
+		}
+	}
+	return nil
+}
+
+// HTTPPeer returns a [Peer] backed by a wiki server at baseURL (e.g. http://127.0.0.1:8080).
+func HTTPPeer(baseURL string, client *http.Client) Peer {
+	return &httpPeer{strings.TrimSuffix(baseURL, "/"), client}
+}
+
+type httpPeer struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (p *httpPeer) revisionURL(id data.ID, revisionID uint64) string {
+	return p.baseURL + "/api/v1/data/" + url.PathEscape(id.String()) + "/revision/" + strconv.FormatUint(revisionID, 10)
+}
+
+func (p *httpPeer) Entries() ([]Entry, error) {
+	resp, err := p.client.Get(p.baseURL + "/api/v1/sync/revisions")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, responseError(resp)
+	}
+	var entries []Entry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("decode entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (p *httpPeer) Open(e Entry) (data.RevisionInfo, io.ReadCloser, error) {
+	resp, err := p.client.Get(p.revisionURL(e.ID, e.RevisionID))
+	if err != nil {
+		return data.RevisionInfo{}, nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return data.RevisionInfo{}, nil, responseError(resp)
+	}
+	info := data.RevisionInfo{ID: e.ID, RevisionID: e.RevisionID}
+	err = ParseRevisionHeaders(resp.Header, &info)
+	if err != nil {
+		resp.Body.Close()
+		return data.RevisionInfo{}, nil, err
+	}
+	return info, resp.Body, nil
+}
+
+func (p *httpPeer) Import(info data.RevisionInfo, r io.Reader) error {
+	req, err := http.NewRequest("PUT", p.revisionURL(info.ID, info.RevisionID), r)
+	if err != nil {
+		return err
+	}
+	SetRevisionHeaders(req.Header, info)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (p *httpPeer) traitURL(e TraitEntry) string {
+	return p.revisionURL(e.ID, e.RevisionID) + "/trait/" + url.PathEscape(e.Name)
+}
+
+func (p *httpPeer) TraitEntries() ([]TraitEntry, error) {
+	resp, err := p.client.Get(p.baseURL + "/api/v1/sync/traits")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, responseError(resp)
+	}
+	var entries []TraitEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("decode trait entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (p *httpPeer) OpenTrait(e TraitEntry) (io.ReadCloser, error) {
+	resp, err := p.client.Get(p.traitURL(e))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (p *httpPeer) PutTrait(e TraitEntry, r io.Reader) error {
+	req, err := http.NewRequest("PUT", p.traitURL(e), r)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL, resp.Status, strings.TrimSpace(string(body)))
+	var e struct{ Code string }
+	if json.Unmarshal(body, &e) == nil && e.Code == "trashed" {
+		// so that Sync can skip the data, as with a local store
+		return fmt.Errorf("%w: %w", data.ErrTrashed, err)
+	}
+	return err
+}
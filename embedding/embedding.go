@@ -0,0 +1,283 @@
+// Package embedding finds similar data by comparing embeddings: vectors of numbers, such that the vectors of texts with similar meanings are close.
+//
+// Embeddings are computed by a local command (e.g. a script running a sentence embedding model), so nothing leaves the machine.
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+// MIMEType is the MIME type of instances of [Class]: a JSON array of numbers.
+const MIMEType = "application/json"
+
+// maxTextSize is the most text passed to the command, as models only look at the start of long texts anyway.
+const maxTextSize = 1 << 20
+
+// Vector is an embedding.
+type Vector []float32
+
+// ParseVector parses the output of an embedding command: either a JSON array of numbers, or numbers separated by whitespace or commas.
+func ParseVector(raw []byte) (Vector, error) {
+	raw = bytes.TrimSpace(raw)
+	if bytes.HasPrefix(raw, []byte("[")) {
+		var v Vector
+		err := json.Unmarshal(raw, &v)
+		if err != nil {
+			return nil, fmt.Errorf("parse vector: %w", err)
+		}
+		if len(v) == 0 {
+			return nil, errors.New("parse vector: empty")
+		}
+		return v, nil
+	}
+	fields := strings.FieldsFunc(string(raw), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("parse vector: empty")
+	}
+	v := make(Vector, len(fields))
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse vector: %w", err)
+		}
+		v[i] = float32(f)
+	}
+	return v, nil
+}
+
+// Similarity returns the cosine similarity of a and b: 1 if they point the same way, and less the further apart they are.
+// Vectors of different lengths (e.g. from different models) have a similarity of 0.
+func Similarity(a, b Vector) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// Class is a class whose instance of a revision is the embedding of its text, as a JSON array of numbers.
+// The text of a revision is its contents for text data (without Markdown syntax for Markdown), and the outputs of the given text classes (e.g. OCR of images).
+//
+// Embeddings are stored as a trait of each revision, named by the class name, so the command is only run once per revision.
+// Like outputs of sometext classes stored in traits, embeddings are not recomputed when the command changes; use a new class name for a new model.
+type Class struct {
+	name string
+	// command is run with the text as stdin, and prints the vector to stdout.
+	command     []string
+	lock        sync.RWMutex
+	textClasses []data.Class
+}
+
+var _ data.ClassContext = (*Class)(nil)
+
+// NewClass returns a class that computes embeddings by running command, with text from revisions and their instances of textClasses.
+func NewClass(name string, command []string, textClasses []data.Class) *Class {
+	return &Class{name: name, command: command, textClasses: textClasses}
+}
+
+func (c *Class) Name() string { return c.name }
+
+// SetTextClasses replaces the classes whose instances are text to embed (e.g. on reloading a configuration).
+// Embeddings computed already are not recomputed.
+func (c *Class) SetTextClasses(textClasses []data.Class) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.textClasses = textClasses
+}
+
+func (c *Class) getTextClasses() []data.Class {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.textClasses
+}
+
+// AttemptInstance returns the embedding of dr, if dr is text, or some text class applies.
+// The command is not run until the instance is read.
+func (c *Class) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
+	return c.AttemptInstanceContext(context.Background(), dr)
+}
+
+// AttemptInstanceContext is [Class.AttemptInstance], but stops attempting text classes when ctx is done.
+func (c *Class) AttemptInstanceContext(ctx context.Context, dr data.DataRevision) (data.Instance, error) {
+	if strings.HasPrefix(dr.MIMEType(), "text/") {
+		return &instance{c, dr}, nil
+	}
+	for _, class := range c.getTextClasses() {
+		i, err := data.AttemptInstanceContext(ctx, class, dr)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err == nil && strings.HasPrefix(i.MIMEType(), "text/") {
+			return &instance{c, dr}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no text", data.ErrNotApplicable)
+}
+
+type instance struct {
+	c  *Class
+	dr data.DataRevision
+}
+
+var _ data.InstanceContext = (*instance)(nil)
+
+func (i *instance) DataRevision() data.DataRevision { return i.dr }
+
+func (i *instance) MIMEType() string { return MIMEType }
+
+func (i *instance) NewReadCloser() (io.ReadCloser, error) {
+	return i.NewReadCloserContext(context.Background())
+}
+
+// NewReadCloserContext is [instance.NewReadCloser], but kills the command when ctx is done.
+func (i *instance) NewReadCloserContext(ctx context.Context) (io.ReadCloser, error) {
+	v, err := i.c.Embedding(ctx, i.dr)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(raw)), nil
+}
+
+// Embedding returns the embedding of dr, from its trait if it was computed before.
+// It returns an error wrapping [data.ErrNotApplicable] if dr has no text.
+func (c *Class) Embedding(ctx context.Context, dr data.DataRevision) (Vector, error) {
+	v, ok, err := c.stored(dr)
+	if err != nil || ok {
+		return v, err
+	}
+	text, err := c.text(ctx, dr)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: no text", data.ErrNotApplicable)
+	}
+	v, err = c.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = dr.Traits().Put(c.name, bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("put trait: %w", err)
+	}
+	return v, nil
+}
+
+// stored returns the embedding of dr stored in its trait, and false if there is none.
+func (c *Class) stored(dr data.DataRevision) (Vector, bool, error) {
+	rc, err := dr.Traits().Get(c.name)
+	if errors.Is(err, data.ErrNoSuchTrait) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("get trait: %w", err)
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, false, fmt.Errorf("get trait: %w", err)
+	}
+	v, err := ParseVector(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// Embed runs the command with text as stdin, and returns the vector it prints.
+// The command is killed when ctx is done.
+func (c *Class) Embed(ctx context.Context, text string) (Vector, error) {
+	log.Printf("running %v", c.command)
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("run %v: %w: %s", c.command, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return ParseVector(out)
+}
+
+// text returns the text of dr to embed.
+func (c *Class) text(ctx context.Context, dr data.DataRevision) (string, error) {
+	var texts []string
+	if dr.MIMEType() == "text/markdown" {
+		text, err := (&wiki.PageRevision{DataRevision: dr}).Text()
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, text)
+	} else if strings.HasPrefix(dr.MIMEType(), "text/") {
+		rc, err := data.NewReadCloserContext(ctx, dr)
+		if err != nil {
+			return "", err
+		}
+		text, err := readText(rc)
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, text)
+	}
+	for _, class := range c.getTextClasses() {
+		i, err := data.AttemptInstanceContext(ctx, class, dr)
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err != nil || !strings.HasPrefix(i.MIMEType(), "text/") {
+			continue
+		}
+		rc, err := data.NewInstanceReadCloserContext(ctx, i)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", class.Name(), err)
+		}
+		text, err := readText(rc)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", class.Name(), err)
+		}
+		texts = append(texts, text)
+	}
+	text := strings.Join(texts, "\n")
+	if len(text) > maxTextSize {
+		text = strings.ToValidUTF8(text[:maxTextSize], "")
+	}
+	return text, nil
+}
+
+// readText reads and closes rc, up to maxTextSize.
+func readText(rc io.ReadCloser) (string, error) {
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxTextSize))
+	return strings.ToValidUTF8(string(b), ""), err
+}
@@ -0,0 +1,104 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func TestParseVector(t *testing.T) {
+	for _, raw := range []string{"[1, -2.5, 3]", "1 -2.5 3\n", "1,-2.5,3"} {
+		v, err := ParseVector([]byte(raw))
+		if err != nil {
+			t.Fatalf("ParseVector(%q): %s", raw, err)
+		}
+		if !slices.Equal(v, Vector{1, -2.5, 3}) {
+			t.Fatalf("ParseVector(%q) = %v", raw, v)
+		}
+	}
+	for _, raw := range []string{"", "[]", "1 two 3"} {
+		_, err := ParseVector([]byte(raw))
+		if err == nil {
+			t.Errorf("ParseVector(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	store := data.NewMemoryDataStore()
+	newData := func(mimeType, source string) data.ID {
+		d, err := store.New(mimeType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = d.NewRevision(strings.NewReader(source), data.RevisionOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.ID()
+	}
+	cats := newData("text/markdown", "# Cats\n\ncat cat cat\n")
+	kitten := newData("text/plain", "a cat and a dog")
+	dogs := newData("text/markdown", "# Dogs\n\ndog dog\n")
+	image := newData("image/png", "png")
+
+	// the embedding counts cats and dogs, and the command logs each run, so that we can check embeddings are stored
+	runs := filepath.Join(t.TempDir(), "runs")
+	command := []string{"sh", "-c", "echo >> " + runs + "; x=$(cat); echo $(echo \"$x\" | grep -o cat | wc -l) $(echo \"$x\" | grep -o dog | wc -l)"}
+	class := NewClass("example.com/embedding", command, nil)
+	x := NewIndex(store, class)
+	err := x.Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := x.Similar(context.Background(), cats, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].ID != kitten || matches[1].ID != dogs || matches[1].Similarity != 0 {
+		t.Fatalf("similar to cats: %+v", matches)
+	}
+	matches, err = x.Search(context.Background(), "dog", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ID != dogs {
+		t.Fatalf("search for dog: %+v", matches)
+	}
+	_, err = x.Similar(context.Background(), image, 0)
+	if !errors.Is(err, data.ErrNotApplicable) {
+		t.Fatalf("similar to an image: %v", err)
+	}
+
+	// data added after the index was built is embedded once, and then indexed
+	bird := newData("text/plain", "a bird")
+	for range 2 {
+		_, err = x.Similar(context.Background(), bird, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := x.vectors[bird]; !ok {
+		t.Fatal("embedding computed by Similar was not indexed")
+	}
+
+	// embeddings are read from traits
+	err = NewIndex(store, class).Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one for each text data, and one for the search
+	if n := strings.Count(string(raw), "\n"); n != 5 {
+		t.Fatalf("command ran %d times", n)
+	}
+}
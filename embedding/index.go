@@ -0,0 +1,213 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// Index keeps the embedding of the latest revision of each data in memory, for nearest-neighbour lookups.
+// Embeddings themselves are stored in traits, so building the index only runs the command for revisions without one.
+// Use [Index.Follow] to keep it up to date.
+type Index struct {
+	store data.DataStore
+	class *Class
+
+	// updateLock serializes updates, so that an older read of data never overwrites a newer one
+	updateLock sync.Mutex
+	lock       sync.RWMutex
+	vectors    map[data.ID]Vector
+}
+
+// NewIndex returns an empty index of the embeddings of data in store, computed by class.
+func NewIndex(store data.DataStore, class *Class) *Index {
+	return &Index{store: store, class: class, vectors: map[data.ID]Vector{}}
+}
+
+// Class returns the class that computes the embeddings.
+func (x *Index) Class() *Class { return x.class }
+
+// read returns the embedding of the latest revision of the data with the given ID, and nil if there is no such data, or it has no text.
+func (x *Index) read(ctx context.Context, id data.ID) (Vector, error) {
+	d, err := data.GetDataByIDContext(ctx, x.store, id)
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dr, err := data.LatestRevision(d)
+	if err != nil || dr == nil {
+		return nil, err
+	}
+	v, err := x.class.Embedding(ctx, dr)
+	if errors.Is(err, data.ErrNotApplicable) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// Rebuild reads the embeddings of all data in the store, computing missing ones.
+// Data whose embedding can't be computed (e.g. as the command failed) is logged and left out.
+func (x *Index) Rebuild(ctx context.Context) error {
+	log.Printf("embedding: rebuilding")
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	ids, err := data.AllIDsContext(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	vectors := map[data.ID]Vector{}
+	for _, id := range ids {
+		v, err := x.read(ctx, id)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			log.Printf("embedding: %s: %s", id, err)
+			continue
+		}
+		if v != nil {
+			vectors[id] = v
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.vectors = vectors
+	return nil
+}
+
+// Update re-reads the data with the given ID, which may have been created, modified, trashed, restored or purged.
+func (x *Index) Update(ctx context.Context, id data.ID) error {
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	v, err := x.read(ctx, id)
+	if err != nil {
+		return fmt.Errorf("embedding of %s: %w", id, err)
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if v == nil {
+		delete(x.vectors, id)
+	} else {
+		x.vectors[id] = v
+	}
+	return nil
+}
+
+// Follow builds the index, and then updates it on changes to the store until ctx is done.
+func (x *Index) Follow(ctx context.Context) error {
+	// watched before building, so that no change is missed in between
+	events, err := data.Watch(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	err = x.Rebuild(ctx)
+	if err != nil {
+		log.Printf("embedding: rebuild: %s", err)
+	}
+	for e := range events {
+		err = x.Update(ctx, e.ID)
+		if err != nil {
+			log.Printf("embedding: update %s: %s", e.ID, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// Match is a result of a nearest-neighbour lookup.
+type Match struct {
+	ID data.ID
+	// Similarity is the cosine similarity to the query (see [Similarity]).
+	Similarity float64
+}
+
+// Nearest returns the data whose embeddings are closest to v, most similar first, except for exclude.
+// At most limit matches are returned (all if limit is 0 or less).
+func (x *Index) Nearest(v Vector, limit int, exclude data.ID) []Match {
+	x.lock.RLock()
+	matches := make([]Match, 0, len(x.vectors))
+	for id, w := range x.vectors {
+		if id == exclude || len(w) != len(v) {
+			continue
+		}
+		matches = append(matches, Match{id, Similarity(v, w)})
+	}
+	x.lock.RUnlock()
+	slices.SortFunc(matches, func(a, b Match) int {
+		if a.Similarity != b.Similarity {
+			if a.Similarity > b.Similarity {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Similar returns the data most similar to the latest revision of the data with the given ID (see [Index.Nearest]).
+// The embedding of the data is computed and added to the index if it is not indexed yet.
+// It returns an error wrapping [data.ErrNotApplicable] if the data has no text.
+func (x *Index) Similar(ctx context.Context, id data.ID, limit int) ([]Match, error) {
+	x.lock.RLock()
+	v, ok := x.vectors[id]
+	x.lock.RUnlock()
+	if !ok {
+		var err error
+		v, err = x.add(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return x.Nearest(v, limit, id), nil
+}
+
+// add computes the embedding of the latest revision of the data with the given ID, and adds it to the index.
+func (x *Index) add(ctx context.Context, id data.ID) (Vector, error) {
+	// like an update, so that a concurrent update of the data isn't overwritten
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	x.lock.RLock()
+	v, ok := x.vectors[id]
+	x.lock.RUnlock()
+	if ok {
+		return v, nil
+	}
+	d, err := data.GetDataByIDContext(ctx, x.store, id)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := data.LatestRevisionContext(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if dr == nil {
+		return nil, fmt.Errorf("data %s: %w", id, data.ErrNoRevisions)
+	}
+	v, err = x.class.Embedding(ctx, dr)
+	if err != nil {
+		return nil, fmt.Errorf("data %s: %w", id, err)
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.vectors[id] = v
+	return v, nil
+}
+
+// Search returns the data most similar in meaning to text (see [Index.Nearest]).
+func (x *Index) Search(ctx context.Context, text string, limit int) ([]Match, error) {
+	v, err := x.class.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return x.Nearest(v, limit, data.ID{}), nil
+}
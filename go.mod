@@ -4,8 +4,10 @@ go 1.23.8
 
 require (
 	github.com/Masterminds/sprig/v3 v3.3.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/google/safehtml v0.1.0
 	github.com/yuin/goldmark v1.7.11
+	go.etcd.io/bbolt v1.4.3
 )
 
 require (
@@ -19,5 +21,6 @@ require (
 	github.com/shopspring/decimal v1.4.0 // indirect
 	github.com/spf13/cast v1.7.0 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 )
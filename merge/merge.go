@@ -0,0 +1,193 @@
+// Package merge implements line-based three-way merges of text documents.
+package merge
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// Result is the outcome of a three-way merge.
+type Result struct {
+	// Merged is the merged document.
+	// If there are conflicts, the conflicting regions are surrounded by conflict markers.
+	Merged []byte
+	// Conflicts is the number of conflicting regions in Merged.
+	Conflicts int
+}
+
+// ThreeWay merges ours and theirs, which were both derived from base.
+// Changes to disjoint regions of base are combined; changes to overlapping regions that are not identical are conflicts.
+// Conflicts are written out with Git-style markers, labelled with oursLabel and theirsLabel.
+func ThreeWay(base, ours, theirs []byte, oursLabel, theirsLabel string) Result {
+	baseLines := splitLines(base)
+	oursLines := splitLines(ours)
+	theirsLines := splitLines(theirs)
+	toOurs := matches(baseLines, oursLines)
+	toTheirs := matches(baseLines, theirsLines)
+
+	var result Result
+	out := new(bytes.Buffer)
+	i, j, k := 0, 0, 0
+	for i < len(baseLines) || j < len(oursLines) || k < len(theirsLines) {
+		// stable region: lines unchanged in both ours and theirs
+		n := 0
+		for i+n < len(baseLines) && toOurs[i+n] == j+n && toTheirs[i+n] == k+n {
+			n++
+		}
+		if n > 0 {
+			writeLines(out, baseLines[i:i+n])
+			i, j, k = i+n, j+n, k+n
+			continue
+		}
+
+		// unstable region: runs until the next base line kept by both sides
+		o, oursEnd, theirsEnd := len(baseLines), len(oursLines), len(theirsLines)
+		for l := i; l < len(baseLines); l++ {
+			if toOurs[l] != -1 && toTheirs[l] != -1 {
+				o, oursEnd, theirsEnd = l, toOurs[l], toTheirs[l]
+				break
+			}
+		}
+		baseChunk := baseLines[i:o]
+		oursChunk := oursLines[j:oursEnd]
+		theirsChunk := theirsLines[k:theirsEnd]
+		switch {
+		case slices.Equal(oursChunk, baseChunk):
+			writeLines(out, theirsChunk)
+		case slices.Equal(theirsChunk, baseChunk), slices.Equal(oursChunk, theirsChunk):
+			writeLines(out, oursChunk)
+		default:
+			result.Conflicts++
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeConflictLines(out, oursChunk)
+			out.WriteString("=======\n")
+			writeConflictLines(out, theirsChunk)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+		i, j, k = o, oursEnd, theirsEnd
+	}
+	result.Merged = out.Bytes()
+	return result
+}
+
+// splitLines splits s into lines, keeping the line terminators.
+func splitLines(s []byte) []string {
+	lines := make([]string, 0, bytes.Count(s, []byte{'\n'})+1)
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n')
+		if i == -1 {
+			lines = append(lines, string(s))
+			break
+		}
+		lines = append(lines, string(s[:i+1]))
+		s = s[i+1:]
+	}
+	return lines
+}
+
+func writeLines(out *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// writeConflictLines is like writeLines, but terminates the last line so that the following conflict marker starts on its own line.
+func writeConflictLines(out *bytes.Buffer, lines []string) {
+	writeLines(out, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteByte('\n')
+	}
+}
+
+// matches returns, for each line in a, the index of the matching line in b according to a longest common subsequence, or -1 if the line is not in the subsequence.
+// It uses the linear-space variant of Myers' diff algorithm ("An O(ND) Difference Algorithm and Its Variations", section 4b),
+// so memory stays proportional to the number of lines even for large documents.
+func matches(a, b []string) []int {
+	m := make([]int, len(a))
+	for i := range m {
+		m[i] = -1
+	}
+	offset := (len(a)+len(b)+1)/2 + 1
+	d := differ{a, b, m, make([]int, 2*offset+1), make([]int, 2*offset+1), offset}
+	d.compare(0, len(a), 0, len(b))
+	return m
+}
+
+type differ struct {
+	a, b []string
+	m    []int
+	// forward and backward are the furthest x reached on each diagonal, indexed by the diagonal plus offset
+	forward, backward []int
+	offset            int
+}
+
+// compare matches a[a0:a1] and b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	// common prefix and suffix are matched directly, which keeps the rest small for typical edits
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.m[a0] = b0
+		a0++
+		b0++
+	}
+	for a0 < a1 && b0 < b1 && d.a[a1-1] == d.b[b1-1] {
+		d.m[a1-1] = b1 - 1
+		a1--
+		b1--
+	}
+	if a0 == a1 || b0 == b1 {
+		return
+	}
+	// without a common prefix or suffix, there are at least two edits, so both sides of the middle snake are smaller
+	x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+	for i := range u - x {
+		d.m[a0+x+i] = b0 + y + i
+	}
+	d.compare(a0, a0+x, b0, b0+y)
+	d.compare(a0+u, a1, b0+v, b1)
+}
+
+// middleSnake returns the start (x, y) and end (u, v), relative to (a0, b0), of the middle snake of a shortest edit script of a[a0:a1] and b[b0:b1]:
+// a run of matching lines that the script goes through after about half of its edits.
+// The search goes both forward from the start and backward from the end until the paths overlap.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	// backward paths are in reversed coordinates, where diagonal k is diagonal delta-k of forward paths
+	d.forward[d.offset+1] = 0
+	d.backward[d.offset+1] = 0
+	for e := 0; e <= (n+m+1)/2; e++ {
+		for k := -e; k <= e; k += 2 {
+			x := d.next(d.forward, k, e)
+			x0, y0 := x, x-k
+			for x < n && x-k < m && d.a[a0+x] == d.b[b0+x-k] {
+				x++
+			}
+			d.forward[d.offset+k] = x
+			if odd && delta-k >= -(e-1) && delta-k <= e-1 && x+d.backward[d.offset+delta-k] >= n {
+				return x0, y0, x, x - k
+			}
+		}
+		for k := -e; k <= e; k += 2 {
+			x := d.next(d.backward, k, e)
+			x0, y0 := x, x-k
+			for x < n && x-k < m && d.a[a1-1-x] == d.b[b1-1-(x-k)] {
+				x++
+			}
+			d.backward[d.offset+k] = x
+			if !odd && delta-k >= -e && delta-k <= e && x+d.forward[d.offset+delta-k] >= n {
+				return n - x, m - (x - k), n - x0, m - y0
+			}
+		}
+	}
+	panic("merge: no middle snake")
+}
+
+// next returns the x to continue the furthest path on diagonal k with e edits from, by an insertion from diagonal k+1 or a deletion from diagonal k-1.
+func (d *differ) next(furthest []int, k, e int) int {
+	if k == -e || (k != e && furthest[d.offset+k-1] < furthest[d.offset+k+1]) {
+		return furthest[d.offset+k+1]
+	}
+	return furthest[d.offset+k-1] + 1
+}
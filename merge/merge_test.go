@@ -0,0 +1,94 @@
+package merge
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestThreeWay(t *testing.T) {
+	cases := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		merged    string
+		conflicts int
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", 0},
+		{"only ours", "a\nb\n", "a\nB\n", "a\nb\n", "a\nB\n", 0},
+		{"only theirs", "a\nb\n", "a\nb\n", "A\nb\n", "A\nb\n", 0},
+		{"disjoint", "a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", 0},
+		{"same change", "a\nb\n", "a\nB\n", "a\nB\n", "a\nB\n", 0},
+		{"insertions", "a\nc\n", "a\nb\nc\n", "a\nc\nd\n", "a\nb\nc\nd\n", 0},
+		{"deletion", "a\nb\nc\n", "a\nc\n", "a\nb\nc\nd\n", "a\nc\nd\n", 0},
+		{"empty base", "", "a\n", "", "a\n", 0},
+		{"no trailing newline", "a\nb\nc", "a\nb\nC", "A\nb\nc", "A\nb\nC", 0},
+		{
+			"conflict",
+			"a\nb\nc\n", "a\nX\nc\n", "a\nY\nc\n",
+			"a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n", 1,
+		},
+		{
+			"conflict without trailing newline",
+			"a", "b", "c",
+			"<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n", 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := ThreeWay([]byte(c.base), []byte(c.ours), []byte(c.theirs), "ours", "theirs")
+			if string(result.Merged) != c.merged {
+				t.Errorf("merged = %q, want %q", result.Merged, c.merged)
+			}
+			if result.Conflicts != c.conflicts {
+				t.Errorf("conflicts = %d, want %d", result.Conflicts, c.conflicts)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, rng.IntN(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return lines
+	}
+	for range 1000 {
+		a, b := randomLines(), randomLines()
+		m := matches(a, b)
+		n, last := 0, -1
+		for i, j := range m {
+			if j == -1 {
+				continue
+			}
+			if j <= last || a[i] != b[j] {
+				t.Fatalf("matches(%q, %q) = %v: not a common subsequence", a, b, m)
+			}
+			n, last = n+1, j
+		}
+		if want := lcsLength(a, b); n != want {
+			t.Fatalf("matches(%q, %q) = %v: %d lines, want %d", a, b, m, n, want)
+		}
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b, the quadratic way.
+func lcsLength(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for x := range lengths {
+		lengths[x] = make([]int, len(b)+1)
+	}
+	for x := len(a) - 1; x >= 0; x-- {
+		for y := len(b) - 1; y >= 0; y-- {
+			if a[x] == b[y] {
+				lengths[x][y] = lengths[x+1][y+1] + 1
+			} else {
+				lengths[x][y] = max(lengths[x+1][y], lengths[x][y+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
@@ -0,0 +1,500 @@
+// Package query finds data matching a query, such as "images whose OCR output contains X".
+//
+// A query is a list of terms separated by spaces, all of which must match.
+// Terms prefixed with "-" must not match.
+// Values containing spaces are quoted like Go strings (e.g. title:"two words").
+//
+//   - mime:<pattern> matches the MIME type, with * as a wildcard (e.g. mime:image/*)
+//   - epoch:<range> matches the time the ID was generated, in Unix seconds or as a date (e.g. epoch:2025-01-01..2025-01-31)
+//   - revisions:<range> matches the number of revisions (e.g. revisions:>1)
+//   - title:<text> matches titles containing text, ignoring case; a term without a field is the same
+//   - links-to:<id> matches data whose latest revision links to the data with the given ID
+//   - linked-from:<id> matches data that the latest revision of the data with the given ID links to
+//   - trait:<name> matches data whose latest revision has the trait, and trait:<name>=<text> if the trait also contains text, ignoring case
+//   - instance:<class> matches data whose latest revision has an instance of the class, and instance:<class>=<text> if the instance also contains text, ignoring case;
+//     classes can be named by the last element of their name (e.g. tesseract for example.com/tesseract)
+//
+// A range is a number, <n, <=n, >n, >=n, or a..b (inclusive, and either side may be omitted).
+// A date in a range covers the whole day (in UTC).
+package query
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+// Query is a parsed query.
+type Query struct {
+	terms []term
+}
+
+// Source is what a query is run against.
+type Source struct {
+	Store data.DataStore
+	// Index has the entries of all data in Store, which are the results of queries.
+	Index *wiki.Index
+	// Classes are the classes instance terms can refer to.
+	Classes []data.Class
+}
+
+// term is a condition on data.
+type term interface {
+	// cost orders terms, so that cheap terms (i.e. those only looking at the index) rule out data before expensive terms read it.
+	cost() int
+	match(ctx context.Context, c *candidate) (bool, error)
+}
+
+// Parse parses a query (see the package documentation).
+// An empty query matches all data.
+func Parse(s string) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{terms: make([]term, 0, len(tokens))}
+	for _, token := range tokens {
+		t, err := parseTerm(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", token, err)
+		}
+		q.terms = append(q.terms, t)
+	}
+	slices.SortStableFunc(q.terms, func(a, b term) int { return a.cost() - b.cost() })
+	return q, nil
+}
+
+// tokenize splits s at spaces outside of double quotes.
+func tokenize(s string) ([]string, error) {
+	tokens := make([]string, 0)
+	var token strings.Builder
+	inQuote := false
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && unicode.IsSpace(r):
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quote")
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// unquote returns s, unquoted if it is quoted.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	return strconv.Unquote(s)
+}
+
+func parseTerm(token string) (term, error) {
+	if rest, ok := strings.CutPrefix(token, "-"); ok {
+		t, err := parseTerm(rest)
+		if err != nil {
+			return nil, err
+		}
+		return notTerm{t}, nil
+	}
+	field, value, ok := strings.Cut(token, ":")
+	if !ok || strings.HasPrefix(field, `"`) {
+		text, err := unquote(token)
+		if err != nil {
+			return nil, err
+		}
+		return titleTerm{strings.ToLower(text)}, nil
+	}
+	switch field {
+	case "mime":
+		pattern, err := unquote(value)
+		if err != nil {
+			return nil, err
+		}
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		return mimeTerm{pattern}, nil
+	case "epoch":
+		r, err := parseRange(value, parseEpoch)
+		if err != nil {
+			return nil, err
+		}
+		return rangeTerm{r, func(entry wiki.IndexEntry) int64 { return entry.ID.Epoch }}, nil
+	case "revisions":
+		r, err := parseRange(value, parseInt)
+		if err != nil {
+			return nil, err
+		}
+		return rangeTerm{r, func(entry wiki.IndexEntry) int64 { return int64(entry.Revisions) }}, nil
+	case "title":
+		text, err := unquote(value)
+		if err != nil {
+			return nil, err
+		}
+		return titleTerm{strings.ToLower(text)}, nil
+	case "links-to", "linked-from":
+		id, err := data.ParseID(value)
+		if err != nil {
+			return nil, err
+		}
+		if field == "links-to" {
+			return linksToTerm{id}, nil
+		}
+		return linkedFromTerm{id}, nil
+	case "trait", "instance":
+		name, text, hasText := strings.Cut(value, "=")
+		if name == "" {
+			return nil, fmt.Errorf("no %s name", field)
+		}
+		var err error
+		text, err = unquote(text)
+		if err != nil {
+			return nil, err
+		}
+		c := contains{strings.ToLower(text), hasText}
+		if field == "trait" {
+			return traitTerm{name, c}, nil
+		}
+		return instanceTerm{name, c}, nil
+	default:
+		return nil, fmt.Errorf("unknown field %s", field)
+	}
+}
+
+// valueRange is an inclusive range of values.
+type valueRange struct {
+	min, max int64
+}
+
+// parseRange parses a range, using parseBound to get the smallest and largest value each bound stands for.
+func parseRange(s string, parseBound func(string) (int64, int64, error)) (valueRange, error) {
+	r := valueRange{math.MinInt64, math.MaxInt64}
+	if a, b, ok := strings.Cut(s, ".."); ok {
+		if a != "" {
+			lo, _, err := parseBound(a)
+			if err != nil {
+				return r, err
+			}
+			r.min = lo
+		}
+		if b != "" {
+			_, hi, err := parseBound(b)
+			if err != nil {
+				return r, err
+			}
+			r.max = hi
+		}
+		return r, nil
+	}
+	// longer operators first, as "<" is a prefix of "<="
+	for _, op := range []string{">=", "<=", ">", "<", ""} {
+		rest, ok := strings.CutPrefix(s, op)
+		if !ok {
+			continue
+		}
+		lo, hi, err := parseBound(rest)
+		if err != nil {
+			return r, err
+		}
+		switch op {
+		case ">=":
+			r.min = lo
+		case "<=":
+			r.max = hi
+		case ">":
+			r.min = hi + 1
+		case "<":
+			r.max = lo - 1
+		default:
+			r.min, r.max = lo, hi
+		}
+		return r, nil
+	}
+	panic("unreachable")
+}
+
+func parseInt(s string) (int64, int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, n, err
+}
+
+// parseEpoch parses Unix seconds, or a date standing for all seconds of the day.
+func parseEpoch(s string) (int64, int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, n, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("neither Unix seconds nor a date: %s", s)
+	}
+	return t.Unix(), t.AddDate(0, 0, 1).Unix() - 1, nil
+}
+
+// candidate is data that is being matched against a query.
+type candidate struct {
+	src   *Source
+	entry wiki.IndexEntry
+	// latest is the latest revision, read when first needed
+	latest data.DataRevision
+}
+
+// latestRevision returns the latest revision of the data, and nil if it has no revisions.
+func (c *candidate) latestRevision(ctx context.Context) (data.DataRevision, error) {
+	if c.latest != nil || c.entry.Revisions == 0 {
+		return c.latest, nil
+	}
+	d, err := data.GetDataByIDContext(ctx, c.src.Store, c.entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	c.latest, err = data.FindRevision(d, c.entry.LatestRevisionID)
+	return c.latest, err
+}
+
+type notTerm struct{ t term }
+
+func (t notTerm) cost() int { return t.t.cost() }
+
+func (t notTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	ok, err := t.t.match(ctx, c)
+	return !ok, err
+}
+
+type mimeTerm struct{ pattern string }
+
+func (t mimeTerm) cost() int { return 0 }
+
+func (t mimeTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	// the pattern was checked by Parse
+	ok, _ := path.Match(t.pattern, c.entry.MIMEType)
+	return ok, nil
+}
+
+type rangeTerm struct {
+	r     valueRange
+	value func(wiki.IndexEntry) int64
+}
+
+func (t rangeTerm) cost() int { return 0 }
+
+func (t rangeTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	v := t.value(c.entry)
+	return t.r.min <= v && v <= t.r.max, nil
+}
+
+type titleTerm struct{ text string }
+
+func (t titleTerm) cost() int { return 0 }
+
+func (t titleTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	return strings.Contains(strings.ToLower(c.entry.Title), t.text), nil
+}
+
+type linksToTerm struct{ id data.ID }
+
+func (t linksToTerm) cost() int { return 0 }
+
+func (t linksToTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	return slices.ContainsFunc(c.entry.Links, func(link wiki.IndexLink) bool { return link.Destination == t.id }), nil
+}
+
+type linkedFromTerm struct{ id data.ID }
+
+func (t linkedFromTerm) cost() int { return 0 }
+
+func (t linkedFromTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	src, ok := c.src.Index.Entry(t.id)
+	if !ok || src.Deleted {
+		return false, nil
+	}
+	return slices.ContainsFunc(src.Links, func(link wiki.IndexLink) bool { return link.Destination == c.entry.ID }), nil
+}
+
+// contains is the optional text condition of trait and instance terms.
+type contains struct {
+	// text is lowercase.
+	text    string
+	hasText bool
+}
+
+// match reports whether r contains the text, if there is a text.
+func (c contains) match(r io.Reader) (bool, error) {
+	if !c.hasText {
+		return true, nil
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(bytes.ToLower(b), []byte(c.text)), nil
+}
+
+type traitTerm struct {
+	name string
+	contains
+}
+
+func (t traitTerm) cost() int { return 1 }
+
+func (t traitTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	dr, err := c.latestRevision(ctx)
+	if err != nil || dr == nil {
+		return false, err
+	}
+	rc, err := dr.Traits().Get(t.name)
+	if errors.Is(err, data.ErrNoSuchTrait) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	return t.contains.match(rc)
+}
+
+type instanceTerm struct {
+	className string
+	contains
+}
+
+// instances run commands, so they go last
+func (t instanceTerm) cost() int { return 2 }
+
+func (t instanceTerm) match(ctx context.Context, c *candidate) (bool, error) {
+	class, err := c.src.class(t.className)
+	if err != nil {
+		return false, err
+	}
+	dr, err := c.latestRevision(ctx)
+	if err != nil || dr == nil {
+		return false, err
+	}
+	ok, err := t.matchInstance(ctx, class, dr)
+	if err != nil && ctx.Err() == nil {
+		// e.g. the command of the class is not installed, or fails on this revision; other data can still match
+		log.Printf("query: %s of %s: %s", class.Name(), dr.Data().ID(), err)
+		return false, nil
+	}
+	return ok, err
+}
+
+func (t instanceTerm) matchInstance(ctx context.Context, class data.Class, dr data.DataRevision) (bool, error) {
+	instance, err := data.AttemptInstanceContext(ctx, class, dr)
+	if errors.Is(err, data.ErrNotApplicable) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !t.hasText {
+		return true, nil
+	}
+	rc, err := data.NewInstanceReadCloserContext(ctx, instance)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	return t.contains.match(rc)
+}
+
+// class returns the class with the given name, or the last element of its name.
+func (src *Source) class(name string) (data.Class, error) {
+	for _, class := range src.Classes {
+		if class.Name() == name || strings.HasSuffix(class.Name(), "/"+name) {
+			return class, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", data.ErrNoSuchClass, name)
+}
+
+// Run calls yield with the index entry of each (non-trashed) data matching q, newest first, until yield returns an error.
+// Errors about the query itself (e.g. a class that doesn't exist) are returned before yield is called.
+// Errors matching some data (e.g. a failing instance command) are logged, and the data doesn't match.
+func (q *Query) Run(ctx context.Context, src Source, yield func(wiki.IndexEntry) error) error {
+	if err := q.check(&src); err != nil {
+		return err
+	}
+	for _, entry := range src.Index.Entries() {
+		if entry.Deleted {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ok, err := q.match(ctx, &candidate{src: &src, entry: entry})
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			// e.g. a revision that can't be read; the rest of the data can still match
+			log.Printf("query %s: %s", entry.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = yield(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns an error if q refers to classes that src doesn't have.
+func (q *Query) check(src *Source) error {
+	for _, t := range q.terms {
+		for {
+			n, ok := t.(notTerm)
+			if !ok {
+				break
+			}
+			t = n.t
+		}
+		if t, ok := t.(instanceTerm); ok {
+			_, err := src.class(t.className)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *Query) match(ctx context.Context, c *candidate) (bool, error) {
+	for _, t := range q.terms {
+		ok, err := t.match(ctx, c)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
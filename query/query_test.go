@@ -0,0 +1,192 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+// upperClass is an instance of text/plain data, with the contents in uppercase.
+type upperClass struct{}
+
+func (upperClass) Name() string { return "example.com/upper" }
+
+func (upperClass) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
+	if dr.MIMEType() != "text/plain" {
+		return nil, fmt.Errorf("%w: not text/plain", data.ErrNotApplicable)
+	}
+	return upperInstance{dr}, nil
+}
+
+type upperInstance struct{ dr data.DataRevision }
+
+func (i upperInstance) DataRevision() data.DataRevision { return i.dr }
+func (i upperInstance) MIMEType() string                { return "text/plain" }
+
+func (i upperInstance) NewReadCloser() (io.ReadCloser, error) {
+	rc, err := i.dr.NewReadCloser()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(strings.ToUpper(string(b)))), nil
+}
+
+// failingClass applies to text/plain data, fails to attempt an instance of images, and has instances of other data that fail to read.
+type failingClass struct{}
+
+func (failingClass) Name() string { return "example.com/failing" }
+
+func (failingClass) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
+	switch {
+	case dr.MIMEType() == "text/plain":
+		return upperInstance{dr}, nil
+	case strings.HasPrefix(dr.MIMEType(), "image/"):
+		return nil, errors.New("attempt failed")
+	}
+	return failingInstance{dr}, nil
+}
+
+type failingInstance struct{ dr data.DataRevision }
+
+func (i failingInstance) DataRevision() data.DataRevision { return i.dr }
+func (i failingInstance) MIMEType() string                { return "text/plain" }
+
+func (i failingInstance) NewReadCloser() (io.ReadCloser, error) {
+	return nil, errors.New("read failed")
+}
+
+func TestRun(t *testing.T) {
+	store := data.NewMemoryDataStore()
+	epoch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	now := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	var n uint64
+	store.NewID = func() data.ID {
+		n++
+		// a day apart
+		return data.ID{Epoch: epoch + int64(n-1)*86400, Random: n}
+	}
+	newData := func(mimeType string, revisions ...string) data.ID {
+		d, err := store.New(mimeType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, source := range revisions {
+			_, err = d.NewRevision(strings.NewReader(source), data.RevisionOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return d.ID()
+	}
+	a := newData("text/markdown", "# Alpha page\n")
+	b := newData("text/markdown", "# Beta\n", "# Beta\n\nsee [A](convind://"+a.String()+")\n")
+	note := newData("text/plain", "a note about cats")
+	image := newData("image/png", "png")
+	d, err := store.GetDataByID(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := data.LatestRevision(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = latest.Traits().Put("example.com/ocr", strings.NewReader("Hello World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := wiki.OpenIndex(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := Source{store, index, []data.Class{upperClass{}, failingClass{}}}
+
+	cases := []struct {
+		query string
+		want  []data.ID
+	}{
+		{"", []data.ID{image, note, b, a}},
+		{"mime:text/*", []data.ID{note, b, a}},
+		{"-mime:text/*", []data.ID{image}},
+		{"revisions:>1", []data.ID{b}},
+		{"revisions:1..1", []data.ID{image, note, a}},
+		{"epoch:2025-01-02", []data.ID{b}},
+		{"epoch:2025-01-02..", []data.ID{image, note, b}},
+		{fmt.Sprintf("epoch:<%d", epoch+86400), []data.ID{a}},
+		{"alpha", []data.ID{a}},
+		{`title:"alpha page"`, []data.ID{a}},
+		{"links-to:" + a.String(), []data.ID{b}},
+		{"linked-from:" + b.String(), []data.ID{a}},
+		{"trait:example.com/ocr", []data.ID{image}},
+		{`trait:example.com/ocr="hello world"`, []data.ID{image}},
+		{"trait:example.com/ocr=goodbye", nil},
+		{"instance:upper", []data.ID{note}},
+		{"instance:example.com/upper=CATS mime:text/plain", []data.ID{note}},
+		{"instance:upper=dogs", nil},
+		{"instance:failing=cats", []data.ID{note}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			q, err := Parse(c.query)
+			if err != nil {
+				t.Fatalf("Parse: %s", err)
+			}
+			var got []data.ID
+			err = q.Run(context.Background(), src, func(entry wiki.IndexEntry) error {
+				got = append(got, entry.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Run: %s", err)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	q, err := Parse("instance:nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.Run(context.Background(), src, func(wiki.IndexEntry) error {
+		t.Fatal("yield called for a query with an unknown class")
+		return nil
+	})
+	if !errors.Is(err, data.ErrNoSuchClass) {
+		t.Fatalf("Run with an unknown class: %v", err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		`title:"unterminated`,
+		"unknown:x",
+		"revisions:many",
+		"epoch:yesterday",
+		"links-to:not-an-id",
+		"trait:",
+		"mime:[",
+	} {
+		_, err := Parse(s)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
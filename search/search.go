@@ -0,0 +1,625 @@
+// Package search keeps a full-text index of data in a [data.DataStore].
+//
+// Indexed text comes from the latest revision of text data (for Markdown pages, without Markdown syntax),
+// and from instances of the given classes that produce text (e.g. OCR output of images).
+// Chinese, Japanese and Korean text is indexed as overlapping pairs of characters, as words are not separated by spaces.
+package search
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+// maxTextSize is the most text read from each source, so that e.g. huge logs don't take over the index.
+const maxTextSize = 1 << 20
+
+// Index is a full-text index of a store, optionally persisted in a bbolt database file.
+// Use [Index.Follow] to keep it up to date.
+type Index struct {
+	store data.DataStore
+	db    *bolt.DB
+
+	// updateLock serializes updates, so that an older read of data never overwrites a newer one
+	updateLock sync.Mutex
+	lock       sync.RWMutex
+	classes    []data.Class
+	docs       map[data.ID]*document
+	// postings has the number of occurrences of each term in each document
+	postings    map[string]map[data.ID]int
+	totalLength int
+	// built is true if the index was built (and not only opened empty)
+	built bool
+	// seq is the sequence number of the latest change in the change log of the store that the index includes
+	seq uint64
+}
+
+// document is the indexed text of data.
+type document struct {
+	ID       data.ID
+	Title    string
+	MIMEType string
+	Texts    []source
+	// Length is the number of terms in all texts.
+	Length int
+}
+
+// source is text from one source.
+type source struct {
+	// Class is the name of the class whose instance produced the text, or empty if it is the data itself.
+	Class string
+	Text  string
+}
+
+// indexVersion is incremented when the tokenization or the format of the database changes, so that persisted indexes are rebuilt.
+const indexVersion = "1"
+
+var (
+	docsBucket     = []byte("docs")
+	postingsBucket = []byte("postings")
+	metaBucket     = []byte("meta")
+	versionKey     = []byte("version")
+	seqKey         = []byte("seq")
+)
+
+// Open returns a search index of store, with text from instances of classes.
+// If path is empty, the index is kept in memory only.
+// Otherwise, it is persisted at path, and the text of data doesn't have to be read again (e.g. by running OCR) after a restart.
+// Open doesn't read the store; see [Index.Follow].
+func Open(store data.DataStore, path string, classes []data.Class) (*Index, error) {
+	x := &Index{store: store, classes: classes, docs: map[data.ID]*document{}, postings: map[string]map[data.ID]int{}}
+	if path == "" {
+		return x, nil
+	}
+	var err error
+	x.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open search index %s: %w", path, err)
+	}
+	err = x.load()
+	if err != nil {
+		x.db.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+// SetClasses replaces the classes whose instances are indexed (e.g. on reloading a configuration).
+// Documents already indexed keep the text of the old classes until their data changes, or the index is rebuilt.
+func (x *Index) SetClasses(classes []data.Class) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.classes = classes
+}
+
+// Close closes the index file, if any.
+func (x *Index) Close() error {
+	if x.db == nil {
+		return nil
+	}
+	return x.db.Close()
+}
+
+// load reads the persisted documents and postings, unless they are from an older version.
+func (x *Index) load() error {
+	return x.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil || string(meta.Get(versionKey)) != indexVersion {
+			return nil
+		}
+		x.built = true
+		if raw := meta.Get(seqKey); raw != nil {
+			x.seq = binary.BigEndian.Uint64(raw)
+		}
+		err := tx.Bucket(docsBucket).ForEach(func(k, v []byte) error {
+			doc := new(document)
+			err := json.Unmarshal(v, doc)
+			if err != nil {
+				return fmt.Errorf("parse search document %s: %w", k, err)
+			}
+			x.docs[doc.ID] = doc
+			x.totalLength += doc.Length
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(postingsBucket).ForEach(func(k, v []byte) error {
+			term, idRaw, ok := strings.Cut(string(k), "\x00")
+			if !ok {
+				return fmt.Errorf("invalid posting key %q", k)
+			}
+			id, err := data.ParseID(idRaw)
+			if err != nil {
+				return err
+			}
+			count, _ := binary.Uvarint(v)
+			if x.postings[term] == nil {
+				x.postings[term] = map[data.ID]int{}
+			}
+			x.postings[term][id] = int(count)
+			return nil
+		})
+	})
+}
+
+func postingKey(term string, id data.ID) []byte {
+	return []byte(term + "\x00" + id.String())
+}
+
+// termCounts returns the number of occurrences of each term in doc, and the number of terms.
+func (doc *document) termCounts() (map[string]int, int) {
+	counts := map[string]int{}
+	length := 0
+	for _, t := range doc.Texts {
+		for _, tok := range tokenize(t.Text, true) {
+			counts[tok.term]++
+			length++
+		}
+	}
+	for _, tok := range tokenize(doc.Title, true) {
+		counts[tok.term]++
+		length++
+	}
+	return counts, length
+}
+
+// read returns the document of the data with the given ID, and nil if there is no such data, or it has no text.
+func (x *Index) read(ctx context.Context, id data.ID) (*document, error) {
+	d, err := data.GetDataByIDContext(ctx, x.store, id)
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dr, err := data.LatestRevision(d)
+	if err != nil || dr == nil {
+		return nil, err
+	}
+	doc := &document{ID: id, MIMEType: dr.MIMEType()}
+	if dr.MIMEType() == "text/markdown" {
+		pr := &wiki.PageRevision{DataRevision: dr}
+		doc.Title, err = pr.Title()
+		if err != nil {
+			return nil, err
+		}
+		text, err := pr.Text()
+		if err != nil {
+			return nil, err
+		}
+		doc.Texts = append(doc.Texts, source{Text: text})
+	} else if strings.HasPrefix(dr.MIMEType(), "text/") {
+		rc, err := data.NewReadCloserContext(ctx, dr)
+		if err != nil {
+			return nil, err
+		}
+		text, err := readText(rc)
+		if err != nil {
+			return nil, err
+		}
+		doc.Texts = append(doc.Texts, source{Text: text})
+	}
+	x.lock.RLock()
+	classes := x.classes
+	x.lock.RUnlock()
+	for _, class := range classes {
+		text, ok, err := instanceText(ctx, class, dr)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			// e.g. the command of the class is not installed; the rest of the data is still searchable
+			log.Printf("search: %s of %s: %s", class.Name(), id, err)
+			continue
+		}
+		if ok {
+			doc.Texts = append(doc.Texts, source{class.Name(), text})
+		}
+	}
+	if len(doc.Texts) == 0 {
+		return nil, nil
+	}
+	return doc, nil
+}
+
+// instanceText returns the text of the instance of class for dr, and false if there is no such instance, or it is not text.
+func instanceText(ctx context.Context, class data.Class, dr data.DataRevision) (string, bool, error) {
+	instance, err := data.AttemptInstanceContext(ctx, class, dr)
+	if errors.Is(err, data.ErrNotApplicable) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	if !strings.HasPrefix(instance.MIMEType(), "text/") {
+		return "", false, nil
+	}
+	rc, err := data.NewInstanceReadCloserContext(ctx, instance)
+	if err != nil {
+		return "", false, err
+	}
+	text, err := readText(rc)
+	return text, err == nil, err
+}
+
+// readText reads and closes rc, up to maxTextSize.
+func readText(rc io.ReadCloser) (string, error) {
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxTextSize))
+	return strings.ToValidUTF8(string(b), ""), err
+}
+
+// Rebuild reads the whole store and replaces all documents.
+func (x *Index) Rebuild(ctx context.Context) error {
+	log.Printf("search: rebuilding")
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	// the change log is read first, so that changes made while reading the store are picked up again by the next Sync
+	seq, err := data.Seq(x.store)
+	if err != nil && !errors.Is(err, data.ErrNoChangeLog) {
+		return err
+	}
+	ids, err := data.AllIDsContext(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	docs := map[data.ID]*document{}
+	for _, id := range ids {
+		doc, err := x.read(ctx, id)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", id, err)
+		}
+		if doc != nil {
+			docs[id] = doc
+		}
+	}
+
+	postings := map[string]map[data.ID]int{}
+	totalLength := 0
+	for id, doc := range docs {
+		var counts map[string]int
+		counts, doc.Length = doc.termCounts()
+		totalLength += doc.Length
+		for term, count := range counts {
+			if postings[term] == nil {
+				postings[term] = map[data.ID]int{}
+			}
+			postings[term][id] = count
+		}
+	}
+	if x.db != nil {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{docsBucket, postingsBucket, metaBucket} {
+				err := tx.DeleteBucket(name)
+				if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+					return err
+				}
+				_, err = tx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+			}
+			for _, doc := range docs {
+				err := putDocument(tx, doc)
+				if err != nil {
+					return err
+				}
+			}
+			for term, counts := range postings {
+				for id, count := range counts {
+					err := tx.Bucket(postingsBucket).Put(postingKey(term, id), binary.AppendUvarint(nil, uint64(count)))
+					if err != nil {
+						return err
+					}
+				}
+			}
+			meta := tx.Bucket(metaBucket)
+			err := meta.Put(seqKey, binary.BigEndian.AppendUint64(nil, seq))
+			if err != nil {
+				return err
+			}
+			return meta.Put(versionKey, []byte(indexVersion))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.docs = docs
+	x.postings = postings
+	x.totalLength = totalLength
+	x.built = true
+	x.seq = seq
+	return nil
+}
+
+func putDocument(tx *bolt.Tx, doc *document) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(docsBucket).Put([]byte(doc.ID.String()), raw)
+}
+
+// Update re-reads the data with the given ID, which may have been created, modified, trashed, restored or purged.
+func (x *Index) Update(ctx context.Context, id data.ID) error {
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	return x.update(ctx, id)
+}
+
+// update is [Index.Update].
+// The caller must hold x.updateLock.
+func (x *Index) update(ctx context.Context, id data.ID) error {
+	doc, err := x.read(ctx, id)
+	if err != nil {
+		return fmt.Errorf("index %s: %w", id, err)
+	}
+	x.lock.RLock()
+	old := x.docs[id]
+	x.lock.RUnlock()
+	var oldCounts, counts map[string]int
+	if old != nil {
+		oldCounts, _ = old.termCounts()
+	}
+	if doc != nil {
+		counts, doc.Length = doc.termCounts()
+	}
+
+	if x.db != nil && x.built {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			for term := range oldCounts {
+				err := tx.Bucket(postingsBucket).Delete(postingKey(term, id))
+				if err != nil {
+					return err
+				}
+			}
+			if doc == nil {
+				return tx.Bucket(docsBucket).Delete([]byte(id.String()))
+			}
+			for term, count := range counts {
+				err := tx.Bucket(postingsBucket).Put(postingKey(term, id), binary.AppendUvarint(nil, uint64(count)))
+				if err != nil {
+					return err
+				}
+			}
+			return putDocument(tx, doc)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	for term := range oldCounts {
+		delete(x.postings[term], id)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	if old != nil {
+		x.totalLength -= old.Length
+		delete(x.docs, id)
+	}
+	if doc != nil {
+		for term, count := range counts {
+			if x.postings[term] == nil {
+				x.postings[term] = map[data.ID]int{}
+			}
+			x.postings[term][id] = count
+		}
+		x.totalLength += doc.Length
+		x.docs[id] = doc
+	}
+	return nil
+}
+
+// Sync updates the documents of data changed since the last Sync (or [Index.Rebuild]), according to the change log of the store.
+// Sync does nothing if the store has no change log.
+func (x *Index) Sync(ctx context.Context) error {
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	x.lock.RLock()
+	since := x.seq
+	x.lock.RUnlock()
+	changes, err := data.Changes(x.store, since)
+	if errors.Is(err, data.ErrNoChangeLog) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	ids := map[data.ID]bool{}
+	for _, change := range changes {
+		ids[change.ID] = true
+	}
+	for id := range ids {
+		err = x.update(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	seq := changes[len(changes)-1].Seq
+	if x.db != nil && x.built {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(metaBucket).Put(seqKey, binary.BigEndian.AppendUint64(nil, seq))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.seq = seq
+	return nil
+}
+
+// Follow brings the index up to date, and then updates it on changes to the store until ctx is done.
+// The index is rebuilt first, unless it was built before and the store has a change log to catch up from.
+func (x *Index) Follow(ctx context.Context) error {
+	// watched before catching up, so that no change is missed in between
+	events, err := data.Watch(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	_, hasChangeLog := x.store.(data.ChangeLog)
+	x.lock.RLock()
+	built := x.built
+	x.lock.RUnlock()
+	if built && hasChangeLog {
+		err = x.Sync(ctx)
+	} else {
+		err = x.Rebuild(ctx)
+	}
+	if err != nil {
+		log.Printf("search: catching up: %s", err)
+	}
+	for e := range events {
+		if hasChangeLog {
+			err = x.Sync(ctx)
+		} else {
+			err = x.Update(ctx, e.ID)
+		}
+		if err != nil {
+			log.Printf("search: update %s: %s", e.ID, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// Hit is a search result.
+type Hit struct {
+	ID       data.ID
+	Title    string
+	MIMEType string
+	Score    float64
+	// Class is the name of the class whose instance the snippet is from, or empty if it is from the data itself.
+	Class string
+	// Snippet is the text around the first match.
+	Snippet string
+}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Search returns the data containing all terms of q, best match first, ranked by BM25.
+// At most limit hits are returned (all if limit is 0 or less).
+func (x *Index) Search(q string, limit int) []Hit {
+	terms := make([]string, 0)
+	for _, tok := range tokenize(q, false) {
+		terms = append(terms, tok.term)
+	}
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+	hits := make([]Hit, 0)
+	if len(terms) == 0 {
+		return hits
+	}
+
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	n := float64(len(x.docs))
+	avgLength := float64(x.totalLength) / max(n, 1)
+	scores := map[data.ID]float64{}
+	for i, term := range terms {
+		postings := x.postings[term]
+		idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for id, count := range postings {
+			if _, ok := scores[id]; !ok && i > 0 {
+				// missed an earlier term
+				continue
+			}
+			tf := float64(count)
+			norm := 1 - bm25B + bm25B*float64(x.docs[id].Length)/max(avgLength, 1)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		// drop documents without this term
+		for id := range scores {
+			if _, ok := postings[id]; !ok {
+				delete(scores, id)
+			}
+		}
+	}
+	for id, score := range scores {
+		doc := x.docs[id]
+		hit := Hit{ID: id, Title: doc.Title, MIMEType: doc.MIMEType, Score: score}
+		hit.Class, hit.Snippet = doc.snippet(terms)
+		hits = append(hits, hit)
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := -compareFloat(a.Score, b.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// snippetContext is the number of bytes of text (roughly) shown before and after the first match in a snippet.
+const snippetContext = 60
+
+// snippet returns the text around the first occurrence of one of terms, and the class of the text it is in.
+func (doc *document) snippet(terms []string) (string, string) {
+	for _, t := range doc.Texts {
+		for _, tok := range tokenize(t.Text, true) {
+			if _, ok := slices.BinarySearch(terms, tok.term); !ok {
+				continue
+			}
+			start := max(0, tok.start-snippetContext)
+			end := min(len(t.Text), tok.end+snippetContext)
+			// don't cut characters in half
+			for start > 0 && !utf8RuneStart(t.Text[start]) {
+				start--
+			}
+			for end < len(t.Text) && !utf8RuneStart(t.Text[end]) {
+				end++
+			}
+			snippet := strings.Join(strings.Fields(t.Text[start:end]), " ")
+			if start > 0 {
+				snippet = "…" + snippet
+			}
+			if end < len(t.Text) {
+				snippet += "…"
+			}
+			return t.Class, snippet
+		}
+	}
+	// only the title matched
+	return "", ""
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xc0 != 0x80
+}
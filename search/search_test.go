@@ -0,0 +1,124 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// ocrClass is a stand-in for OCR: its instance of image/png data is the contents.
+type ocrClass struct{}
+
+func (ocrClass) Name() string { return "example.com/ocr" }
+
+func (ocrClass) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
+	if dr.MIMEType() != "image/png" {
+		return nil, fmt.Errorf("%w: not image/png", data.ErrNotApplicable)
+	}
+	return ocrInstance{dr}, nil
+}
+
+type ocrInstance struct{ dr data.DataRevision }
+
+func (i ocrInstance) DataRevision() data.DataRevision       { return i.dr }
+func (i ocrInstance) MIMEType() string                      { return "text/plain" }
+func (i ocrInstance) NewReadCloser() (io.ReadCloser, error) { return i.dr.NewReadCloser() }
+
+func newData(t *testing.T, store data.DataStore, mimeType, source string) data.Data {
+	d, err := store.New(mimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(strings.NewReader(source), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func searchIDs(x *Index, q string) []data.ID {
+	var ids []data.ID
+	for _, hit := range x.Search(q, 0) {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	store := data.NewMemoryDataStore()
+	cats := newData(t, store, "text/markdown", "# Cats\n\nCats are **small** animals. Cats like boxes.\n")
+	dogs := newData(t, store, "text/markdown", "# Dogs\n\nDogs are animals too.\n")
+	receipt := newData(t, store, "image/png", "領収書 東京都 合計 1200円")
+
+	path := filepath.Join(t.TempDir(), "search.db")
+	x, err := Open(store, path, []data.Class{ocrClass{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := searchIDs(x, "animals")
+	if len(ids) != 2 || ids[0] != dogs.ID() || ids[1] != cats.ID() {
+		// Dogs is shorter, so animals weighs more in it
+		t.Fatalf("animals: got %v", ids)
+	}
+	hits := x.Search("cats boxes", 0)
+	if len(hits) != 1 || hits[0].ID != cats.ID() || hits[0].Title != "Cats" || !strings.Contains(hits[0].Snippet, "Cats are small animals") {
+		t.Fatalf("cats boxes: got %+v", hits)
+	}
+	hits = x.Search("東京", 0)
+	if len(hits) != 1 || hits[0].ID != receipt.ID() || hits[0].Class != "example.com/ocr" {
+		t.Fatalf("東京: got %+v", hits)
+	}
+	if ids := searchIDs(x, "京都"); len(ids) != 1 {
+		t.Fatalf("京都: got %v", ids)
+	}
+	if ids := searchIDs(x, "大阪"); len(ids) != 0 {
+		t.Fatalf("大阪: got %v", ids)
+	}
+
+	// updated through the change log
+	_, err = dogs.NewRevision(strings.NewReader("# Dogs\n\nDogs like boxes.\n"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteByID(cats.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := searchIDs(x, "boxes"); len(ids) != 1 || ids[0] != dogs.ID() {
+		t.Fatalf("boxes after sync: got %v", ids)
+	}
+	if ids := searchIDs(x, "animals"); len(ids) != 0 {
+		t.Fatalf("animals after sync: got %v", ids)
+	}
+
+	// persisted
+	err = x.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err = Open(store, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	if ids := searchIDs(x, "boxes"); len(ids) != 1 || ids[0] != dogs.ID() {
+		t.Fatalf("boxes after reopening: got %v", ids)
+	}
+	if ids := searchIDs(x, "合計"); len(ids) != 1 || ids[0] != receipt.ID() {
+		t.Fatalf("合計 after reopening: got %v", ids)
+	}
+}
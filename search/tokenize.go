@@ -0,0 +1,93 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a term in a text, and where it is.
+type token struct {
+	term string
+	// start and end are the byte offsets of the term in the text.
+	start, end int
+}
+
+// isCJK returns whether r is written without spaces between words (Chinese, Japanese and Korean), so words can't be told apart.
+func isCJK(r rune) bool {
+	// the prolonged sound mark (ー) is common to hiragana and katakana, so it is not in either script
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー'
+}
+
+// normalize folds case and full-width forms of ASCII (e.g. Ａ, common in Japanese text) into lowercase ASCII.
+func normalize(r rune) rune {
+	if 0xff01 <= r && r <= 0xff5e {
+		r -= 0xff01 - 0x21
+	}
+	return unicode.ToLower(r)
+}
+
+// tokenize splits s into terms.
+// Runs of letters and digits are one term each.
+// Runs of CJK characters are split into overlapping pairs of characters (bigrams), as there are no spaces between words;
+// with unigrams, each character is also a term, so that searches for a single character can match.
+func tokenize(s string, unigrams bool) []token {
+	tokens := make([]token, 0)
+	// run is the current run of characters of the same kind
+	type char struct {
+		r     rune
+		start int
+	}
+	var run []char
+	runCJK := false
+	flush := func(end int) {
+		if len(run) == 0 {
+			return
+		}
+		if !runCJK {
+			var sb strings.Builder
+			for _, c := range run {
+				sb.WriteRune(c.r)
+			}
+			tokens = append(tokens, token{sb.String(), run[0].start, end})
+		} else {
+			for i, c := range run {
+				next := end
+				if i+1 < len(run) {
+					next = run[i+1].start
+				}
+				if unigrams || len(run) == 1 {
+					tokens = append(tokens, token{string(c.r), c.start, next})
+				}
+				if i+1 < len(run) {
+					after := end
+					if i+2 < len(run) {
+						after = run[i+2].start
+					}
+					tokens = append(tokens, token{string([]rune{c.r, run[i+1].r}), c.start, after})
+				}
+			}
+		}
+		run = run[:0]
+	}
+	for i, r := range s {
+		r = normalize(r)
+		switch {
+		case isCJK(r):
+			if !runCJK {
+				flush(i)
+			}
+			runCJK = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if runCJK {
+				flush(i)
+			}
+			runCJK = false
+		default:
+			flush(i)
+			continue
+		}
+		run = append(run, char{r, i})
+	}
+	flush(len(s))
+	return tokens
+}
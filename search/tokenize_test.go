@@ -0,0 +1,30 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		s        string
+		unigrams bool
+		want     []string
+	}{
+		{"Hello, World! 42", false, []string{"hello", "world", "42"}},
+		{"ＡＢＣ１２３", false, []string{"abc123"}},
+		{"東京タワー", false, []string{"東京", "京タ", "タワ", "ワー"}},
+		{"東京", true, []string{"東", "東京", "京"}},
+		{"猫", false, []string{"猫"}},
+		{"OCRで読む", false, []string{"ocr", "で読", "読む"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, tok := range tokenize(c.s, c.unigrams) {
+			got = append(got, tok.term)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("tokenize(%q, %t) = %q, want %q", c.s, c.unigrams, got, c.want)
+		}
+	}
+}
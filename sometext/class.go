@@ -2,6 +2,7 @@ package sometext
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"inaba.kiyuri.ca/2025/convind/data"
 )
@@ -24,7 +26,7 @@ var errNotMatch = errors.New("does not match")
 // The command is run with stdin as the file.
 func MakePrefixHandler(prefix string, command []string) HandlerFunc {
 	return func(dr data.DataRevision) ([]string, error) {
-		if !strings.HasPrefix(dr.Data().MIMEType(), prefix) {
+		if !strings.HasPrefix(dr.MIMEType(), prefix) {
 			return nil, errNotMatch
 		}
 		return command, nil
@@ -38,10 +40,50 @@ type SometextClass struct {
 	// Handlers are attempted first to last; if two handlers match, the first one will be chosen.
 	handlers       []HandlerFunc
 	outputMIMEType string
+	// storeInTraits is true if outputs are stored as traits instead of in a temporary directory.
+	storeInTraits bool
+	// limits restricts the commands run (see [SometextClass.SetLimits]).
+	limits Limits
+}
+
+// Limits restricts the commands of a [SometextClass], which may run on untrusted data (e.g. uploaded by anyone who can reach wiki-server).
+//
+// Regardless of limits, commands run in a new, empty working directory (also their HOME and TMPDIR), which is removed afterwards,
+// with an environment of only PATH, HOME, TMPDIR and Env.
+// Commands are killed together with any processes they started.
+type Limits struct {
+	// Timeout is how long commands can run before they are killed, or 0 for no limit.
+	Timeout time.Duration
+	// MaxOutputBytes is the most output commands can write before they are killed, or 0 for no limit.
+	MaxOutputBytes int64
+	// Env is added to the environment of commands, as KEY=value (e.g. TESSDATA_PREFIX=…).
+	Env []string
+	// Sandbox runs commands in new Linux namespaces, without network access, and without seeing or signalling other processes.
+	// It needs unprivileged user namespaces, and is not supported on other OSes.
+	// Note that files readable by the user running the server are still readable; wrap commands in e.g. bwrap to restrict that.
+	Sandbox bool
+	// MaxMemoryBytes limits the address space of commands (RLIMIT_AS), or 0 for no limit. Linux only.
+	MaxMemoryBytes uint64
+	// MaxCPUTime limits the CPU time of commands (RLIMIT_CPU, rounded up to seconds), or 0 for no limit. Linux only.
+	// Resource limits are set by running commands with prlimit(1) from util-linux.
+	MaxCPUTime time.Duration
 }
 
 func NewSometextClass(name string, handlers []HandlerFunc, mimeType string) *SometextClass {
-	return &SometextClass{name, handlers, mimeType}
+	return &SometextClass{name: name, handlers: handlers, outputMIMEType: mimeType}
+}
+
+// SetStoreInTraits sets whether outputs are stored as traits of each revision (named by the class name), instead of in [os.TempDir].
+// Traits are kept in the data store, so commands are only run once per revision, even across restarts and (when synced) machines.
+// Note that outputs are keyed by class name, so outputs are not recomputed when the command of a class changes.
+func (s *SometextClass) SetStoreInTraits(storeInTraits bool) {
+	s.storeInTraits = storeInTraits
+}
+
+// SetLimits sets the limits of commands (no limits by default).
+// Output of killed commands is not kept, so they are run again the next time.
+func (s *SometextClass) SetLimits(limits Limits) {
+	s.limits = limits
 }
 
 func (s *SometextClass) Name() string { return s.name }
@@ -56,19 +98,7 @@ func (s *SometextClass) AttemptInstance(dr data.DataRevision) (data.Instance, er
 		cachePath := filepath.Join(os.TempDir(), dr.Data().ID().String()+strconv.FormatUint(dr.RevisionID(), 10)+base64.URLEncoding.EncodeToString([]byte(fmt.Sprint(command))))
 		return &commandInstance{dr, s, command, cachePath}, nil
 	}
-	return nil, errors.New("no matched handlers")
-}
-
-type passthroughInstance struct {
-	dr data.DataRevision
-}
-
-func (i *passthroughInstance) DataRevision() data.DataRevision { return i.dr }
-
-func (i *passthroughInstance) MIMEType() string { return i.dr.Data().MIMEType() }
-
-func (i *passthroughInstance) NewReadCloser() (io.ReadCloser, error) {
-	return i.dr.NewReadCloser()
+	return nil, fmt.Errorf("%w: no matched handlers", data.ErrNotApplicable)
 }
 
 type commandInstance struct {
@@ -78,16 +108,26 @@ type commandInstance struct {
 	cachePath string
 }
 
+var _ data.InstanceContext = (*commandInstance)(nil)
+
 func (i *commandInstance) DataRevision() data.DataRevision { return i.dr }
 
 func (i *commandInstance) MIMEType() string {
 	if i.c.outputMIMEType == "PASSTHROUGH" {
-		return i.dr.Data().MIMEType()
+		return i.dr.MIMEType()
 	}
 	return i.c.outputMIMEType
 }
 
 func (i *commandInstance) NewReadCloser() (io.ReadCloser, error) {
+	return i.NewReadCloserContext(context.Background())
+}
+
+// NewReadCloserContext is [commandInstance.NewReadCloser], but kills the command when ctx is done.
+func (i *commandInstance) NewReadCloserContext(ctx context.Context) (io.ReadCloser, error) {
+	if i.c.storeInTraits {
+		return i.newReadCloserFromTraits(ctx)
+	}
 	f, err := os.Open(i.cachePath)
 	if err == nil {
 		return f, nil
@@ -98,19 +138,11 @@ func (i *commandInstance) NewReadCloser() (io.ReadCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create cache file: %w", err)
 	}
-	stdin, err := i.dr.NewReadCloser()
-	if err != nil {
-		f.Close()
-		return nil, fmt.Errorf("NewReadCloser: %w", err)
-	}
-	defer stdin.Close()
-	log.Printf("running %v", i.command)
-	cmd := exec.Command(i.command[0], i.command[1:]...)
-	cmd.Stdin = stdin
-	cmd.Stdout = f
-	err = cmd.Run()
+	err = i.run(ctx, f)
 	if err != nil {
 		f.Close()
+		// don't leave partial output (e.g. of a killed command) in the cache
+		os.Remove(i.cachePath)
 		return nil, err
 	}
 	_, err = f.Seek(0, 0)
@@ -122,6 +154,117 @@ func (i *commandInstance) NewReadCloser() (io.ReadCloser, error) {
 	return f, nil
 }
 
+// newReadCloserFromTraits returns the output stored in the trait named by the class name, running the command first if there is no such trait.
+func (i *commandInstance) newReadCloserFromTraits(ctx context.Context) (io.ReadCloser, error) {
+	traits := i.dr.Traits()
+	rc, err := traits.Get(i.c.name)
+	if err == nil {
+		return rc, nil
+	} else if !errors.Is(err, data.ErrNoSuchTrait) {
+		return nil, fmt.Errorf("get trait: %w", err)
+	}
+	f, err := os.CreateTemp("", "convind-sometext-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	err = i.run(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = traits.Put(i.c.name, f)
+	if err != nil {
+		return nil, fmt.Errorf("put trait: %w", err)
+	}
+	return traits.Get(i.c.name)
+}
+
+var (
+	errTimedOut            = errors.New("timed out")
+	errOutputTooLarge      = errors.New("output too large")
+	errSandboxNotSupported = errors.New("sandboxing is not supported on this OS")
+)
+
+// run runs the command with the revision as stdin, writing stdout to w.
+// The command is killed when ctx is done, or it exceeds the limits of the class.
+func (i *commandInstance) run(ctx context.Context, w io.Writer) error {
+	limits := i.c.limits
+	if limits.Sandbox && !sandboxSupported {
+		return errSandboxNotSupported
+	}
+	command, err := limitCommand(i.command, limits)
+	if err != nil {
+		return fmt.Errorf("limit %v: %w", i.command, err)
+	}
+	stdin, err := i.dr.NewReadCloser()
+	if err != nil {
+		return fmt.Errorf("NewReadCloser: %w", err)
+	}
+	defer stdin.Close()
+	dir, err := os.MkdirTemp("", "convind-sometext-run-")
+	if err != nil {
+		return fmt.Errorf("create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, limits.Timeout, errTimedOut)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if limits.MaxOutputBytes > 0 {
+		w = &limitedWriter{w, limits.MaxOutputBytes, cancel}
+	}
+
+	log.Printf("running %v", i.command)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = w
+	cmd.Dir = dir
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir}, limits.Env...)
+	// e.g. a child left running in the background may keep stdout open
+	cmd.WaitDelay = time.Second
+	setupCommand(cmd, limits)
+	err = cmd.Start()
+	if err != nil {
+		if limits.Sandbox {
+			return fmt.Errorf("start %v in a sandbox (are unprivileged user namespaces enabled?): %w", i.command, err)
+		}
+		return err
+	}
+	err = cmd.Wait()
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errTimedOut):
+		return fmt.Errorf("%v: timed out after %s: %w", i.command, limits.Timeout, context.DeadlineExceeded)
+	case errors.Is(cause, errOutputTooLarge):
+		return fmt.Errorf("%v: output larger than %d bytes", i.command, limits.MaxOutputBytes)
+	}
+	return err
+}
+
+// limitedWriter writes up to n bytes, and then cancels the command.
+type limitedWriter struct {
+	w      io.Writer
+	n      int64
+	cancel context.CancelCauseFunc
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		l.cancel(errOutputTooLarge)
+		return 0, errOutputTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
 type buffer struct {
 	*bytes.Buffer
 }
@@ -0,0 +1,193 @@
+package sometext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func TestStoreInTraits(t *testing.T) {
+	store := data.NewFSDataStoreFromSubdirectory(t.TempDir())
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("hello"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the command logs each run, so that we can check it is only run once
+	runs := filepath.Join(t.TempDir(), "runs")
+	c := NewSometextClass("example.com/upper", []HandlerFunc{
+		MakePrefixHandler("text/", []string{"sh", "-c", "echo >> " + runs + "; tr a-z A-Z"}),
+	}, "text/plain")
+	c.SetStoreInTraits(true)
+	for range 2 {
+		instance, err := c.AttemptInstance(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := instance.NewReadCloser()
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != "HELLO" {
+			t.Fatalf("output = %q", output)
+		}
+	}
+	log, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 {
+		t.Fatalf("command ran %d times", len(log))
+	}
+	rc, err := dr.Traits().Get("example.com/upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+}
+
+func TestCancel(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	store := data.NewMemoryDataStore()
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("hello"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSometextClass("example.com/slow", []HandlerFunc{
+		MakePrefixHandler("text/", []string{"sh", "-c", "exec sleep 10"}),
+	}, "text/plain")
+	instance, err := c.AttemptInstance(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = data.NewInstanceReadCloserContext(ctx, instance)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("command was not killed")
+	}
+	// partial output must not be cached
+	if _, err := os.Stat(instance.(*commandInstance).cachePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("cache file: %v", err)
+	}
+}
+
+// runCommand runs command as a text/plain class with limits on "hello", and returns its output.
+func runCommand(t *testing.T, command []string, limits Limits) (string, error) {
+	t.Helper()
+	store := data.NewMemoryDataStore()
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("hello"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSometextClass("example.com/test", []HandlerFunc{MakePrefixHandler("text/", command)}, "text/plain")
+	c.SetLimits(limits)
+	instance, err := c.AttemptInstance(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := data.NewInstanceReadCloserContext(context.Background(), instance)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	return string(b), err
+}
+
+func TestLimits(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("CONVIND_SECRET", "secret")
+
+	out, err := runCommand(t, []string{"sh", "-c", `echo "$CONVIND_SECRET:$FOO:$PWD"; touch junk`}, Limits{Env: []string{"FOO=bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimSpace(out), ":")
+	if len(fields) != 3 || fields[0] != "" || fields[1] != "bar" || filepath.Dir(fields[2]) != tmp {
+		t.Fatalf("environment and working directory: %q", out)
+	}
+	if _, err := os.Stat(fields[2]); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("working directory was not removed: %v", err)
+	}
+
+	_, err = runCommand(t, []string{"sh", "-c", "while :; do echo yes; done"}, Limits{MaxOutputBytes: 100})
+	if err == nil || !strings.Contains(err.Error(), "output larger than 100 bytes") {
+		t.Fatalf("command with too much output: %v", err)
+	}
+
+	// the background sleep must be killed too, or Wait would wait for it
+	start := time.Now()
+	_, err = runCommand(t, []string{"sh", "-c", "sleep 10 & wait"}, Limits{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("command that times out: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("command was not killed")
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	if !sandboxSupported {
+		t.Skip("resource limits are not supported on this OS")
+	}
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("no prlimit")
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	// the limits are set before the shell starts, in seconds and KiB
+	out, err := runCommand(t, []string{"sh", "-c", "ulimit -t; ulimit -v"}, Limits{MaxMemoryBytes: 1 << 30, MaxCPUTime: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(out); !slices.Equal(got, []string{"2", "1048576"}) {
+		t.Fatalf("limits = %q", out)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	if !sandboxSupported {
+		t.Skip("sandboxing is not supported on this OS")
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	// in a new PID namespace, the command is PID 1
+	out, err := runCommand(t, []string{"sh", "-c", "echo $$"}, Limits{Sandbox: true, MaxMemoryBytes: 1 << 30, MaxCPUTime: time.Minute})
+	if err != nil && strings.Contains(err.Error(), "user namespaces") {
+		t.Skipf("no user namespaces: %s", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out) != "1" {
+		t.Fatalf("PID in sandbox = %q", out)
+	}
+}
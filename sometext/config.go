@@ -0,0 +1,181 @@
+package sometext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config lists sometext classes, usually loaded from a JSON file (see [LoadConfig]), e.g.
+//
+//	{"Classes": [{
+//		"Name": "example.com/tesseract",
+//		"Handlers": [{"MIMEPrefix": "image/", "Command": ["tesseract", "-", "-"]}],
+//		"OutputMIMEType": "text/plain",
+//		"Timeout": "2m",
+//		"MaxOutputBytes": 1048576,
+//		"Sandbox": true,
+//		"Search": true
+//	}]}
+type Config struct {
+	Classes []ClassConfig
+}
+
+// ClassConfig is the configuration of a [SometextClass].
+type ClassConfig struct {
+	// Name is the name of the class (see [data.Class.Name]).
+	Name string
+	// Handlers are attempted first to last; the first matching one is run.
+	Handlers []HandlerConfig
+	// OutputMIMEType is the MIME type of the output of the commands, or PASSTHROUGH for the MIME type of the revision.
+	OutputMIMEType string
+	// Timeout is how long commands can run (e.g. "30s") before they are killed; empty for no timeout.
+	Timeout string
+	// MaxOutputBytes, Env, Sandbox and MaxMemoryBytes are the same as in [Limits].
+	MaxOutputBytes int64
+	Env            []string
+	Sandbox        bool
+	MaxMemoryBytes uint64
+	// MaxCPUTime is [Limits.MaxCPUTime] (e.g. "1m"); empty for no limit.
+	MaxCPUTime string
+	// Disabled classes are left out, so they can be turned off without deleting them.
+	Disabled bool
+	// Search is true if the output is text to find data by (e.g. OCR), for full-text search and embeddings.
+	Search bool
+}
+
+// HandlerConfig is the configuration of a handler made by [MakePrefixHandler].
+type HandlerConfig struct {
+	// MIMEPrefix is the prefix of MIME types of revisions the handler applies to (e.g. "image/"); empty for all.
+	MIMEPrefix string
+	// Command is run with the revision as stdin, and its output as stdout.
+	Command []string
+}
+
+// LoadConfig reads and validates the config at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ParseConfig reads and validates a config.
+// Unknown fields are errors, so that typos don't silently change nothing.
+func ParseConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	c := new(Config)
+	err := dec.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns all problems with c (also in disabled classes, so they can be enabled later), joined by [errors.Join].
+func (c *Config) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, cc := range c.Classes {
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("class %d (%q): %s", i, cc.Name, fmt.Sprintf(format, a...)))
+		}
+		if cc.Name == "" {
+			fail("no name")
+		} else if seen[cc.Name] {
+			fail("duplicate name")
+		}
+		seen[cc.Name] = true
+		if len(cc.Handlers) == 0 {
+			fail("no handlers")
+		}
+		for j, h := range cc.Handlers {
+			if len(h.Command) == 0 || h.Command[0] == "" {
+				fail("handler %d: no command", j)
+			}
+		}
+		if cc.OutputMIMEType == "" {
+			fail("no output MIME type")
+		} else if cc.OutputMIMEType != "PASSTHROUGH" {
+			_, _, err := mime.ParseMediaType(cc.OutputMIMEType)
+			if err != nil {
+				fail("output MIME type: %s", err)
+			}
+		}
+		for _, field := range []struct{ name, value string }{{"Timeout", cc.Timeout}, {"MaxCPUTime", cc.MaxCPUTime}} {
+			d, err := parseOptionalDuration(field.value)
+			if err != nil {
+				fail("%s: %s", field.name, err)
+			} else if d < 0 || (field.value != "" && d == 0) {
+				fail("%s: must be positive", field.name)
+			}
+		}
+		if cc.MaxOutputBytes < 0 {
+			fail("MaxOutputBytes: must not be negative")
+		}
+		for _, kv := range cc.Env {
+			if k, _, ok := strings.Cut(kv, "="); !ok || k == "" {
+				fail("Env: %q is not KEY=value", kv)
+			}
+		}
+		if !sandboxSupported && (cc.Sandbox || cc.MaxMemoryBytes > 0 || cc.MaxCPUTime != "") {
+			fail("Sandbox, MaxMemoryBytes and MaxCPUTime are not supported on this OS")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewClasses returns the enabled classes of c, and the ones whose output is for search.
+// c must be valid (see [Config.Validate]).
+func (c *Config) NewClasses() (classes, search []*SometextClass) {
+	for _, cc := range c.Classes {
+		if cc.Disabled {
+			continue
+		}
+		handlers := make([]HandlerFunc, len(cc.Handlers))
+		for i, h := range cc.Handlers {
+			handlers[i] = MakePrefixHandler(h.MIMEPrefix, h.Command)
+		}
+		class := NewSometextClass(cc.Name, handlers, cc.OutputMIMEType)
+		// durations are validated already
+		timeout, _ := parseOptionalDuration(cc.Timeout)
+		maxCPUTime, _ := parseOptionalDuration(cc.MaxCPUTime)
+		class.SetLimits(Limits{
+			Timeout:        timeout,
+			MaxOutputBytes: cc.MaxOutputBytes,
+			Env:            cc.Env,
+			Sandbox:        cc.Sandbox,
+			MaxMemoryBytes: cc.MaxMemoryBytes,
+			MaxCPUTime:     maxCPUTime,
+		})
+		classes = append(classes, class)
+		if cc.Search {
+			search = append(search, class)
+		}
+	}
+	return classes, search
+}
+
+// parseOptionalDuration parses s, which is 0 if empty.
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,65 @@
+package sometext
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(`{"Classes": [
+		{"Name": "example.com/upper", "Handlers": [{"MIMEPrefix": "text/", "Command": ["tr", "a-z", "A-Z"]}], "OutputMIMEType": "text/plain", "Search": true},
+		{"Name": "example.com/slow", "Handlers": [{"Command": ["sleep", "10"]}], "OutputMIMEType": "PASSTHROUGH", "Timeout": "10ms"},
+		{"Name": "example.com/off", "Handlers": [{"Command": ["false"]}], "OutputMIMEType": "text/plain", "Disabled": true}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes, search := c.NewClasses()
+	if len(classes) != 2 || classes[0].Name() != "example.com/upper" || classes[1].Name() != "example.com/slow" {
+		t.Fatalf("classes = %v", classes)
+	}
+	if len(search) != 1 || search[0] != classes[0] {
+		t.Fatalf("search classes = %v", search)
+	}
+
+	store := data.NewMemoryDataStore()
+	d, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := d.NewRevision(strings.NewReader("hello"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, err := classes[1].AttemptInstance(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = data.NewInstanceReadCloserContext(context.Background(), instance)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("NewReadCloser of a command that times out: %v", err)
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain", "Typo": 1}]}`,
+		`{"Classes": [{"Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain"}]}`,
+		`{"Classes": [{"Name": "a", "OutputMIMEType": "text/plain"}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": []}], "OutputMIMEType": "text/plain"}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "not a type"}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain", "Timeout": "soon"}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain", "MaxCPUTime": "0s"}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain", "Env": ["NOVALUE"]}]}`,
+		`{"Classes": [{"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain"}, {"Name": "a", "Handlers": [{"Command": ["true"]}], "OutputMIMEType": "text/plain"}]}`,
+	} {
+		_, err := ParseConfig(strings.NewReader(raw))
+		if err == nil {
+			t.Errorf("ParseConfig(%s) succeeded", raw)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package sometext
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const sandboxSupported = true
+
+// setupCommand makes cmd kill its whole process group when canceled, and run in new namespaces if limits.Sandbox.
+func setupCommand(cmd *exec.Cmd, limits Limits) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if !limits.Sandbox {
+		return
+	}
+	// the user namespace allows creating the others without privileges; users and groups are mapped to themselves
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+}
+
+// limitCommand returns command wrapped with prlimit(1) from util-linux if limits has resource limits.
+// prlimit sets the limits on itself and then execs the command, so they apply from its start, and to the processes it starts.
+func limitCommand(command []string, limits Limits) ([]string, error) {
+	var options []string
+	if limits.MaxMemoryBytes > 0 {
+		options = append(options, "--as="+strconv.FormatUint(limits.MaxMemoryBytes, 10))
+	}
+	if limits.MaxCPUTime > 0 {
+		seconds := uint64((limits.MaxCPUTime + time.Second - 1) / time.Second)
+		options = append(options, "--cpu="+strconv.FormatUint(seconds, 10))
+	}
+	if len(options) == 0 {
+		return command, nil
+	}
+	prlimit, err := exec.LookPath("prlimit")
+	if err != nil {
+		return nil, fmt.Errorf("resource limits need prlimit from util-linux: %w", err)
+	}
+	wrapped := append([]string{prlimit}, options...)
+	wrapped = append(wrapped, "--")
+	return append(wrapped, command...), nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package sometext
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const sandboxSupported = false
+
+// setupCommand does nothing, as only the command itself (and not the processes it starts) can be killed portably.
+func setupCommand(cmd *exec.Cmd, limits Limits) {}
+
+// limitCommand returns an error if limits has resource limits, as they are not supported on this OS.
+func limitCommand(command []string, limits Limits) ([]string, error) {
+	if limits.MaxMemoryBytes > 0 || limits.MaxCPUTime > 0 {
+		return nil, errors.New("resource limits are not supported on this OS")
+	}
+	return command, nil
+}
@@ -4,10 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
 	"slices"
 	"strings"
-	"time"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
@@ -158,145 +156,48 @@ func truncateText(text string, maxLength int) string {
 	return text[len(text)-maxLength:]
 }
 
+// WikiClass shows links between pages (and other data linked from pages), using an [Index].
 type WikiClass struct {
-	dataStore data.DataStore
-
-	aList              []wikiEdge
-	titles             map[data.ID]string
-	mimeTypes          map[data.ID]string
-	latestCreationTime time.Time
-}
-
-type wikiEdge struct {
-	Src        data.ID
-	Dst        data.ID
-	SrcContext string
+	index *Index
 }
 
-func NewWikiClass(dataStore data.DataStore) *WikiClass {
-	return &WikiClass{
-		dataStore: dataStore,
-	}
+func NewWikiClass(index *Index) *WikiClass {
+	return &WikiClass{index: index}
 }
 
 func (c *WikiClass) Name() string {
 	return "inaba.kiyuri.ca/2025/convind/wiki"
 }
 
-func (c *WikiClass) getLatestCreationTime() (time.Time, error) {
-	var latestCreationTime time.Time
-	ids, err := c.dataStore.AllIDs()
-	if err != nil {
-		return time.Time{}, nil
-	}
-	for _, id := range ids {
-		d, err := c.dataStore.GetDataByID(id)
-		if err != nil {
-			return time.Time{}, nil
-		}
-		dr, err := data.LatestRevision(d)
-		if err != nil {
-			return time.Time{}, nil
-		}
-		if dr == nil {
-			continue
-		}
-		ct := dr.CreationTime()
-		if ct.After(latestCreationTime) {
-			latestCreationTime = ct
-		}
-	}
-	return latestCreationTime, nil
-}
-
-func (c *WikiClass) ReloadIfOutdated() error {
-	lct, err := c.getLatestCreationTime()
-	if err != nil {
-		return err
-	}
-	if lct.After(c.latestCreationTime) {
-		c.latestCreationTime = lct
-		return c.Load()
-	}
-	return nil
+type wikiEdge struct {
+	Src        data.ID
+	Dst        data.ID
+	SrcContext string
 }
 
-func (c *WikiClass) Load() error {
-	log.Printf("WikiClass.Load")
-	ids, err := c.dataStore.AllIDs()
-	if err != nil {
-		return err
-	}
-	c.titles = map[data.ID]string{}
-	c.mimeTypes = map[data.ID]string{}
-	for _, id := range ids {
-		d, err := c.dataStore.GetDataByID(id)
-		if err != nil {
-			return err
-		}
-		c.mimeTypes[id] = d.MIMEType()
-		if d.MIMEType() != "text/markdown" {
-			continue
-		}
-		page := Page{d}
-		pr, err := page.LatestRevision()
-		if err != nil {
-			return err
-		}
-		if pr == nil {
+// edges returns all links between data, except links from trashed data.
+func (c *WikiClass) edges() []wikiEdge {
+	edges := make([]wikiEdge, 0)
+	for _, entry := range c.index.Entries() {
+		if entry.Deleted {
 			continue
 		}
-		c.titles[id], err = pr.Title()
-		if err != nil {
-			return err
-		}
-		rc, err := pr.DataRevision.NewReadCloser()
-		if err != nil {
-			return err
-		}
-		links, err := getLinks(rc)
-		if err != nil {
-			return err
-		}
-		slices.SortFunc(links, func(a, b link) int {
-			return strings.Compare(a.Destination, b.Destination)
-		})
-		links = slices.CompactFunc(links, func(a, b link) bool {
-			return a.Destination == b.Destination && a.Context == b.Context
-		})
-		for _, link := range links {
-			if strings.HasPrefix(link.Destination, "convind://") {
-				id2, err := data.ParseID(link.Destination[10:])
-				if err != nil {
-					continue
-				}
-				c.aList = append(c.aList, wikiEdge{
-					Src:        id,
-					Dst:        id2,
-					SrcContext: link.Context,
-				})
-			} else if strings.HasPrefix(link.Destination, "/api/v1/data/") {
-				id2, err := data.ParseID(link.Destination[13:])
-				if err != nil {
-					continue
-				}
-				c.aList = append(c.aList, wikiEdge{
-					Src:        id,
-					Dst:        id2,
-					SrcContext: link.Context,
-				})
-			}
+		for _, link := range entry.Links {
+			edges = append(edges, wikiEdge{entry.ID, link.Destination, link.Context})
 		}
 	}
-	return nil
+	return edges
 }
 
 func (c *WikiClass) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
-	c.ReloadIfOutdated()
+	aList := c.edges()
 	// non text/markdown files may be linked to
-	i := WikiInstance{class: c, title: c.titles[dr.Data().ID()]}
-	for _, edge := range c.aList {
-		if edge.Src == dr.Data().ID() {
+	entry, _ := c.index.Entry(dr.Data().ID())
+	i := WikiInstance{class: c, title: entry.Title}
+	// links from the data are those of its latest revision, which older revisions of another MIME type (e.g. before a note was converted to Markdown) don't have
+	hasLinks := dr.MIMEType() == "text/markdown"
+	for _, edge := range aList {
+		if edge.Src == dr.Data().ID() && hasLinks {
 			i.hop1 = append(i.hop1, hopWithContext{edge.Dst, ""})
 		} else if edge.Dst == dr.Data().ID() {
 			i.hop1 = append(i.hop1, hopWithContext{edge.Src, edge.SrcContext})
@@ -308,23 +209,18 @@ func (c *WikiClass) AttemptInstance(dr data.DataRevision) (data.Instance, error)
 	i.hop1 = slices.CompactFunc(i.hop1, func(a, b hopWithContext) bool {
 		return a.ID == b.ID && a.Context == b.Context
 	})
-	// sort.Slice(i.hop1, func(j, k int) bool {
-	// 	return i.hop1[j].String() < i.hop1[k].String()
-	// })
-	for _, edge := range c.aList {
-		if slices.ContainsFunc(i.hop1, func(h hopWithContext) bool { return h.ID.String() == edge.Src.String() }) {
+	for _, edge := range aList {
+		if slices.ContainsFunc(i.hop1, func(h hopWithContext) bool { return h.ID == edge.Src }) {
 			i.hop2 = append(i.hop2, edge.Dst)
 		}
-		if slices.ContainsFunc(i.hop1, func(h hopWithContext) bool { return h.ID.String() == edge.Dst.String() }) {
+		if slices.ContainsFunc(i.hop1, func(h hopWithContext) bool { return h.ID == edge.Dst }) {
 			i.hop2 = append(i.hop2, edge.Src)
 		}
 	}
 	slices.SortFunc(i.hop2, func(a, b data.ID) int {
 		return strings.Compare(a.String(), b.String())
 	})
-	i.hop2 = slices.CompactFunc(i.hop2, func(a, b data.ID) bool {
-		return a.String() == b.String()
-	})
+	i.hop2 = slices.Compact(i.hop2)
 	return &i, nil
 }
 
@@ -352,16 +248,20 @@ type pageEntry struct {
 	Title    string
 	Context  string
 	MIMEType string
+	// Deleted is true if the page is in the trash.
+	Deleted bool
 }
 
 func (i *WikiInstance) NewReadCloser() (io.ReadCloser, error) {
 	hop1 := make([]pageEntry, len(i.hop1))
 	for j := range i.hop1 {
-		hop1[j] = pageEntry{ID: i.hop1[j].ID, Title: i.class.titles[i.hop1[j].ID], Context: i.hop1[j].Context, MIMEType: i.class.mimeTypes[i.hop1[j].ID]}
+		entry, _ := i.class.index.Entry(i.hop1[j].ID)
+		hop1[j] = pageEntry{ID: i.hop1[j].ID, Title: entry.Title, Context: i.hop1[j].Context, MIMEType: entry.MIMEType, Deleted: entry.Deleted}
 	}
 	hop2 := make([]pageEntry, len(i.hop2))
 	for j := range i.hop2 {
-		hop2[j] = pageEntry{ID: i.hop2[j], Title: i.class.titles[i.hop2[j]], MIMEType: i.class.mimeTypes[i.hop2[j]]}
+		entry, _ := i.class.index.Entry(i.hop2[j])
+		hop2[j] = pageEntry{ID: i.hop2[j], Title: entry.Title, MIMEType: entry.MIMEType, Deleted: entry.Deleted}
 	}
 	data := map[string]interface{}{"1": hop1, "2": hop2, "title": i.title}
 	buf := new(bytes.Buffer)
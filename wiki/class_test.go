@@ -0,0 +1,144 @@
+package wiki
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// newTestStore returns a MemoryDataStore with a clock that advances by one second on each use, and sequential IDs.
+func newTestStore() *data.MemoryDataStore {
+	store := data.NewMemoryDataStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	var n uint64
+	store.NewID = func() data.ID {
+		n++
+		return data.ID{Epoch: 1, Random: n}
+	}
+	store.NewRevisionID = func() uint64 {
+		n++
+		return n
+	}
+	return store
+}
+
+func newTestPage(t *testing.T, store data.DataStore, source string) data.ID {
+	d, err := store.New("text/markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(strings.NewReader(source), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.ID()
+}
+
+type testHops struct {
+	Hop1  []pageEntry `json:"1"`
+	Hop2  []pageEntry `json:"2"`
+	Title string      `json:"title"`
+}
+
+func getHops(t *testing.T, c *WikiClass, store data.DataStore, id data.ID) testHops {
+	d, err := store.GetDataByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := data.LatestRevision(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, err := c.AttemptInstance(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := instance.NewReadCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var hops testHops
+	err = json.NewDecoder(rc).Decode(&hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hops
+}
+
+func titles(entries []pageEntry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Title
+		if entry.Deleted {
+			result[i] += " (deleted)"
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestWikiClassBacklinks(t *testing.T) {
+	store := newTestStore()
+	a := newTestPage(t, store, "# A\n\nsee [B](convind://"+data.ID{Epoch: 1, Random: 3}.String()+")\n")
+	b := newTestPage(t, store, "# B\n\nsee [C](/api/v1/data/"+data.ID{Epoch: 1, Random: 5}.String()+")\n")
+	c := newTestPage(t, store, "# C\n\nno links\n")
+	d := newTestPage(t, store, "# D\n\nsee [C](convind://"+c.String()+")\n")
+	if b != (data.ID{Epoch: 1, Random: 3}) || c != (data.ID{Epoch: 1, Random: 5}) {
+		t.Fatalf("unexpected IDs %s %s", b, c)
+	}
+
+	index, err := OpenIndex(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	class := NewWikiClass(index)
+	cases := []struct {
+		id    data.ID
+		title string
+		hop1  []string
+		hop2  []string
+	}{
+		{a, "A", []string{"B"}, []string{"A", "C"}},
+		{b, "B", []string{"A", "C"}, []string{"B", "D"}},
+		{c, "C", []string{"B", "D"}, []string{"A", "C"}},
+		{d, "D", []string{"C"}, []string{"B", "D"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			hops := getHops(t, class, store, tc.id)
+			if hops.Title != tc.title {
+				t.Errorf("title = %q, want %q", hops.Title, tc.title)
+			}
+			if got := titles(hops.Hop1); !slices.Equal(got, tc.hop1) {
+				t.Errorf("hop 1 = %v, want %v", got, tc.hop1)
+			}
+			if got := titles(hops.Hop2); !slices.Equal(got, tc.hop2) {
+				t.Errorf("hop 2 = %v, want %v", got, tc.hop2)
+			}
+		})
+	}
+
+	// through the index, so that it sees the deletion
+	err = index.Store().DeleteByID(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hops := getHops(t, class, store, d)
+	if len(hops.Hop1) != 1 || hops.Hop1[0].ID != c || !hops.Hop1[0].Deleted {
+		t.Fatalf("link to trashed data not marked as deleted: %v", hops.Hop1)
+	}
+	hops = getHops(t, class, store, b)
+	// trashed data keeps its title
+	if got := titles(hops.Hop1); !slices.Equal(got, []string{"A", "C (deleted)"}) {
+		t.Fatalf("hop 1 of B = %v", got)
+	}
+}
@@ -0,0 +1,612 @@
+package wiki
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// IndexEntry summarizes data, so that pages can be listed and links followed without reading every data.
+type IndexEntry struct {
+	ID       data.ID
+	MIMEType string
+	// Revisions is the number of revisions.
+	Revisions          int
+	LatestRevisionID   uint64
+	LatestCreationTime time.Time
+	// Title and Links are only set for text/markdown data.
+	Title string
+	Links []IndexLink
+	// Deleted is true if the data is in the trash.
+	// Trashed data keeps its title (as it may still be linked to), but not its links.
+	Deleted bool
+	// Seq is the sequence number of the latest change to the data (see [data.ChangeLog]), or 0 if the store has no change log.
+	Seq uint64
+}
+
+// IndexLink is a link to other data.
+type IndexLink struct {
+	Destination data.ID
+	// Context is the text surrounding the link.
+	Context string
+}
+
+// Index keeps an [IndexEntry] for each data in a store, optionally persisted in a bbolt database file.
+// The index is updated on writes made through [Index.Store], and can be rebuilt with [Index.Rebuild] (e.g. after the store was modified by another program).
+// If the store keeps a change log (see [data.ChangeLog]), changes by other programs are picked up by [Index.Sync] instead.
+type Index struct {
+	store data.DataStore
+	db    *bolt.DB
+
+	// updateLock serializes updates, so that an older read of data never overwrites a newer one
+	updateLock sync.Mutex
+	lock       sync.RWMutex
+	entries    map[data.ID]IndexEntry
+	// generation is incremented on every change
+	generation uint64
+	// seq is the sequence number of the latest change in the change log of the store that the entries include
+	seq uint64
+}
+
+// indexVersion is incremented when the format of [IndexEntry] changes, so that persisted indexes are rebuilt.
+const indexVersion = "2"
+
+var (
+	indexEntriesBucket = []byte("entries")
+	indexMetaBucket    = []byte("meta")
+	indexVersionKey    = []byte("version")
+	indexSeqKey        = []byte("seq")
+)
+
+// OpenIndex returns an index of store.
+// If path is empty, the index is built in memory by reading the whole store.
+// Otherwise, the index is persisted at path, and the store is only read fully if the index is new or from an older version;
+// data added or removed while the index was closed are picked up by comparing IDs, and other changes (e.g. new revisions) from the change log of the store, if it has one (see [Index.Sync]).
+func OpenIndex(store data.DataStore, path string) (*Index, error) {
+	x := &Index{store: store, entries: map[data.ID]IndexEntry{}}
+	if path == "" {
+		return x, x.Rebuild()
+	}
+	var err error
+	x.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open index %s: %w", path, err)
+	}
+	upToDate, err := x.load()
+	if err == nil && upToDate {
+		err = x.reconcile()
+		if err == nil {
+			err = x.Sync()
+		}
+	} else if err == nil {
+		err = x.Rebuild()
+	}
+	if err != nil {
+		x.db.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+// Close closes the index file, if any.
+func (x *Index) Close() error {
+	if x.db == nil {
+		return nil
+	}
+	return x.db.Close()
+}
+
+// load reads the persisted entries, and returns false if the index needs to be rebuilt.
+func (x *Index) load() (bool, error) {
+	upToDate := false
+	err := x.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(indexMetaBucket)
+		if meta == nil || string(meta.Get(indexVersionKey)) != indexVersion {
+			return nil
+		}
+		upToDate = true
+		if raw := meta.Get(indexSeqKey); raw != nil {
+			x.seq = binary.BigEndian.Uint64(raw)
+		}
+		return tx.Bucket(indexEntriesBucket).ForEach(func(k, v []byte) error {
+			var entry IndexEntry
+			err := json.Unmarshal(v, &entry)
+			if err != nil {
+				return fmt.Errorf("parse index entry %s: %w", k, err)
+			}
+			x.entries[entry.ID] = entry
+			return nil
+		})
+	})
+	return upToDate, err
+}
+
+// reconcile updates entries of data created or deleted while the index was closed.
+func (x *Index) reconcile() error {
+	ids, err := x.store.AllIDs()
+	if err != nil {
+		return err
+	}
+	stale := map[data.ID]bool{}
+	for _, id := range ids {
+		if entry, ok := x.entries[id]; !ok || entry.Deleted {
+			stale[id] = true
+		}
+	}
+	exists := make(map[data.ID]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = true
+	}
+	for id, entry := range x.entries {
+		if !entry.Deleted && !exists[id] {
+			stale[id] = true
+		}
+	}
+	for id := range stale {
+		err = x.Update(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rebuild reads the whole store and replaces all entries.
+func (x *Index) Rebuild() error {
+	return x.RebuildContext(context.Background())
+}
+
+// RebuildContext is [Index.Rebuild], but stops when ctx is done, keeping the existing entries.
+func (x *Index) RebuildContext(ctx context.Context) error {
+	log.Printf("Index.Rebuild")
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	// the change log is read first, so that changes made while reading the store are picked up again by the next Sync
+	var seq uint64
+	seqs := map[data.ID]uint64{}
+	changes, err := data.Changes(x.store, 0)
+	if err != nil && !errors.Is(err, data.ErrNoChangeLog) {
+		return err
+	}
+	for _, change := range changes {
+		seqs[change.ID] = change.Seq
+		seq = change.Seq
+	}
+	entries := map[data.ID]IndexEntry{}
+	ids, err := data.AllIDsContext(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		d, err := data.GetDataByIDContext(ctx, x.store, id)
+		if err != nil {
+			return err
+		}
+		entry, err := indexData(d)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", id, err)
+		}
+		entry.Seq = seqs[id]
+		entries[id] = entry
+	}
+	trash, err := x.store.Trash()
+	if err != nil {
+		return err
+	}
+	for _, trashed := range trash {
+		entries[trashed.ID] = IndexEntry{ID: trashed.ID, MIMEType: trashed.MIMEType, Deleted: true, Seq: seqs[trashed.ID]}
+	}
+
+	if x.db != nil {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			err := tx.DeleteBucket(indexEntriesBucket)
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			bucket, err := tx.CreateBucket(indexEntriesBucket)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				err = putIndexEntry(bucket, entry)
+				if err != nil {
+					return err
+				}
+			}
+			meta, err := tx.CreateBucketIfNotExists(indexMetaBucket)
+			if err != nil {
+				return err
+			}
+			err = meta.Put(indexSeqKey, binary.BigEndian.AppendUint64(nil, seq))
+			if err != nil {
+				return err
+			}
+			return meta.Put(indexVersionKey, []byte(indexVersion))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.entries = entries
+	x.seq = seq
+	x.generation++
+	return nil
+}
+
+func putIndexEntry(bucket *bolt.Bucket, entry IndexEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(entry.ID.String()), raw)
+}
+
+// Update re-reads the data with the given ID, which may have been created, modified, trashed, restored or purged.
+// The Seq of the entry is kept; use [Index.Sync] for stores with a change log.
+func (x *Index) Update(id data.ID) error {
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	x.lock.RLock()
+	seq := x.entries[id].Seq
+	x.lock.RUnlock()
+	return x.update(id, seq)
+}
+
+// update is [Index.Update], setting the Seq of the entry to seq.
+// The caller must hold x.updateLock.
+func (x *Index) update(id data.ID, seq uint64) error {
+	var entry IndexEntry
+	exists := true
+	d, err := x.store.GetDataByID(id)
+	if errors.Is(err, os.ErrNotExist) {
+		entry, exists, err = x.trashedEntry(id)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		entry, err = indexData(d)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", id, err)
+		}
+	}
+	entry.Seq = seq
+
+	if x.db != nil {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(indexEntriesBucket)
+			if !exists {
+				return bucket.Delete([]byte(id.String()))
+			}
+			return putIndexEntry(bucket, entry)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if exists {
+		x.entries[id] = entry
+	} else {
+		delete(x.entries, id)
+	}
+	x.generation++
+	return nil
+}
+
+// Sync updates the entries of data changed since the last Sync (or [Index.Rebuild]), according to the change log of the store.
+// Sync does nothing if the store has no change log.
+func (x *Index) Sync() error {
+	x.updateLock.Lock()
+	defer x.updateLock.Unlock()
+	x.lock.RLock()
+	since := x.seq
+	x.lock.RUnlock()
+	changes, err := data.Changes(x.store, since)
+	if errors.Is(err, data.ErrNoChangeLog) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	// each data is read once, however many times it changed
+	seqs := map[data.ID]uint64{}
+	for _, change := range changes {
+		seqs[change.ID] = change.Seq
+	}
+	for id, seq := range seqs {
+		err = x.update(id, seq)
+		if err != nil {
+			return err
+		}
+	}
+	seq := changes[len(changes)-1].Seq
+	if x.db != nil {
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(indexMetaBucket).Put(indexSeqKey, binary.BigEndian.AppendUint64(nil, seq))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.seq = seq
+	return nil
+}
+
+// Seq returns the sequence number of the latest change to the store included in the index, and false if the store has no change log.
+func (x *Index) Seq() (uint64, bool) {
+	if _, ok := x.store.(data.ChangeLog); !ok {
+		return 0, false
+	}
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.seq, true
+}
+
+// trashedEntry returns the entry of trashed data, and false if the data is not in the trash either.
+func (x *Index) trashedEntry(id data.ID) (IndexEntry, bool, error) {
+	trash, err := x.store.Trash()
+	if err != nil {
+		return IndexEntry{}, false, err
+	}
+	i := slices.IndexFunc(trash, func(entry data.TrashEntry) bool { return entry.ID == id })
+	if i == -1 {
+		return IndexEntry{}, false, nil
+	}
+	x.lock.RLock()
+	entry := x.entries[id]
+	x.lock.RUnlock()
+	entry.ID = id
+	entry.MIMEType = trash[i].MIMEType
+	entry.Links = nil
+	entry.Deleted = true
+	return entry, true, nil
+}
+
+// indexData reads d and returns its entry.
+func indexData(d data.Data) (IndexEntry, error) {
+	entry := IndexEntry{ID: d.ID(), MIMEType: d.MIMEType()}
+	revisions, err := d.Revisions()
+	if err != nil {
+		return entry, err
+	}
+	entry.Revisions = len(revisions)
+	if len(revisions) == 0 {
+		return entry, nil
+	}
+	// revisions are sorted newest first
+	latest := revisions[0]
+	entry.LatestRevisionID = latest.RevisionID()
+	entry.LatestCreationTime = latest.CreationTime()
+	if latest.MIMEType() != "text/markdown" {
+		return entry, nil
+	}
+	pr := &PageRevision{latest}
+	entry.Title, err = pr.Title()
+	if err != nil {
+		return entry, err
+	}
+	rc, err := latest.NewReadCloser()
+	if err != nil {
+		return entry, err
+	}
+	defer rc.Close()
+	entry.Links, err = getIndexLinks(rc)
+	return entry, err
+}
+
+// getIndexLinks returns the links to other data in the Markdown source, sorted by destination.
+func getIndexLinks(source io.Reader) ([]IndexLink, error) {
+	links, err := getLinks(source)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]IndexLink, 0, len(links))
+	for _, link := range links {
+		var idRaw string
+		if rest, ok := strings.CutPrefix(link.Destination, "convind://"); ok {
+			idRaw = rest
+		} else if rest, ok := strings.CutPrefix(link.Destination, "/api/v1/data/"); ok {
+			idRaw = rest
+		} else {
+			continue
+		}
+		id, err := data.ParseID(idRaw)
+		if err != nil {
+			continue
+		}
+		result = append(result, IndexLink{id, link.Context})
+	}
+	slices.SortFunc(result, func(a, b IndexLink) int {
+		if c := strings.Compare(a.Destination.String(), b.Destination.String()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Context, b.Context)
+	})
+	return slices.Compact(result), nil
+}
+
+// Entry returns the entry of the data with the given ID.
+func (x *Index) Entry(id data.ID) (IndexEntry, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	entry, ok := x.entries[id]
+	return entry, ok
+}
+
+// Entries returns all entries (including trashed data), sorted newest to oldest by the creation time of the latest revision.
+func (x *Index) Entries() []IndexEntry {
+	x.lock.RLock()
+	entries := make([]IndexEntry, 0, len(x.entries))
+	for _, entry := range x.entries {
+		entries = append(entries, entry)
+	}
+	x.lock.RUnlock()
+	slices.SortFunc(entries, func(a, b IndexEntry) int {
+		if c := b.LatestCreationTime.Compare(a.LatestCreationTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return entries
+}
+
+// Generation returns a number that changes whenever the index changes.
+func (x *Index) Generation() uint64 {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.generation
+}
+
+// Follow updates the index on changes to the store made by others (e.g. by another process writing to an [data.FSDataStore]), until ctx is done.
+func (x *Index) Follow(ctx context.Context) error {
+	events, err := data.Watch(ctx, x.store)
+	if err != nil {
+		return err
+	}
+	for e := range events {
+		err = x.updateOrSync(e.ID)
+		if err != nil {
+			log.Printf("index: update %s: %s", e.ID, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// updateOrSync syncs the index if the store has a change log (which includes the change to the data with the given ID), and updates the data otherwise.
+func (x *Index) updateOrSync(id data.ID) error {
+	if _, ok := x.store.(data.ChangeLog); ok {
+		return x.Sync()
+	}
+	return x.Update(id)
+}
+
+// Store returns a [data.DataStore] that updates the index on writes.
+// Revisions must be created through [data.Data] returned by this store (not e.g. [data.DataRevision.Data]) to be indexed.
+func (x *Index) Store() data.DataStore {
+	return &indexedStore{x.store, x}
+}
+
+var (
+	_ data.DataStoreContext = (*indexedStore)(nil)
+	_ data.Watcher          = (*indexedStore)(nil)
+	_ data.ChangeLog        = (*indexedStore)(nil)
+)
+
+type indexedStore struct {
+	data.DataStore
+	index *Index
+}
+
+// update updates the index after a successful write.
+// Failing to update the index doesn't fail the write, as the data itself is saved.
+func (s *indexedStore) update(id data.ID) {
+	err := s.index.updateOrSync(id)
+	if err != nil {
+		log.Printf("index: update %s: %s", id, err)
+	}
+}
+
+func (s *indexedStore) AllIDsContext(ctx context.Context) ([]data.ID, error) {
+	return data.AllIDsContext(ctx, s.DataStore)
+}
+
+func (s *indexedStore) Watch(ctx context.Context) (<-chan data.Event, error) {
+	return data.Watch(ctx, s.DataStore)
+}
+
+func (s *indexedStore) Seq() (uint64, error) {
+	return data.Seq(s.DataStore)
+}
+
+func (s *indexedStore) Changes(since uint64) ([]data.Change, error) {
+	return data.Changes(s.DataStore, since)
+}
+
+func (s *indexedStore) GetDataByID(id data.ID) (data.Data, error) {
+	d, err := s.DataStore.GetDataByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &indexedData{d, s}, nil
+}
+
+func (s *indexedStore) New(mimeType string) (data.Data, error) {
+	d, err := s.DataStore.New(mimeType)
+	if err != nil {
+		return nil, err
+	}
+	s.update(d.ID())
+	return &indexedData{d, s}, nil
+}
+
+func (s *indexedStore) DeleteByID(id data.ID) error {
+	err := s.DataStore.DeleteByID(id)
+	if err == nil {
+		s.update(id)
+	}
+	return err
+}
+
+func (s *indexedStore) RestoreByID(id data.ID) error {
+	err := s.DataStore.RestoreByID(id)
+	if err == nil {
+		s.update(id)
+	}
+	return err
+}
+
+func (s *indexedStore) PurgeByID(id data.ID) error {
+	err := s.DataStore.PurgeByID(id)
+	if err == nil {
+		s.update(id)
+	}
+	return err
+}
+
+func (s *indexedStore) ImportRevision(info data.RevisionInfo, r io.Reader) (data.DataRevision, error) {
+	dr, err := s.DataStore.ImportRevision(info, r)
+	if err == nil {
+		s.update(info.ID)
+	}
+	return dr, err
+}
+
+type indexedData struct {
+	data.Data
+	store *indexedStore
+}
+
+var _ data.DataContext = (*indexedData)(nil)
+
+func (d *indexedData) RevisionsContext(ctx context.Context) ([]data.DataRevision, error) {
+	return data.RevisionsContext(ctx, d.Data)
+}
+
+func (d *indexedData) NewRevision(r io.Reader, opts data.RevisionOptions) (data.DataRevision, error) {
+	dr, err := d.Data.NewRevision(r, opts)
+	if err == nil {
+		d.store.update(d.ID())
+	}
+	return dr, err
+}
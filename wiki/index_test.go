@@ -0,0 +1,121 @@
+package wiki
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func TestIndexReopen(t *testing.T) {
+	store := newTestStore()
+	path := filepath.Join(t.TempDir(), "index.db")
+	index, err := OpenIndex(store, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestPage(t, index.Store(), "# A\n")
+	err = index.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// added while the index is closed
+	b := newTestPage(t, store, "# B\n\nsee [A](convind://"+a.String()+")\n")
+
+	index, err = OpenIndex(store, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	entries := index.Entries()
+	if len(entries) != 2 || entries[0].ID != b || entries[1].ID != a {
+		t.Fatalf("entries = %+v", entries)
+	}
+	entry, ok := index.Entry(b)
+	if !ok || entry.Title != "B" || len(entry.Links) != 1 || entry.Links[0].Destination != a {
+		t.Fatalf("entry of B = %+v", entry)
+	}
+}
+
+func TestIndexSync(t *testing.T) {
+	store := newTestStore()
+	a := newTestPage(t, store, "# A\n")
+	index, err := OpenIndex(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, ok := index.Seq()
+	if !ok || seq == 0 {
+		t.Fatalf("Seq = %d, %t", seq, ok)
+	}
+
+	// edited without going through the index
+	d, err := store.GetDataByID(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.NewRevision(strings.NewReader("# A2\n"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := index.Entry(a); entry.Title != "A" {
+		t.Fatalf("entry of A before Sync = %+v", entry)
+	}
+	err = index.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := index.Entry(a)
+	latest, _ := store.Seq()
+	if entry.Title != "A2" || entry.Seq != latest {
+		t.Fatalf("entry of A after Sync = %+v, want Seq %d", entry, latest)
+	}
+	if seq, _ := index.Seq(); seq != latest {
+		t.Fatalf("Seq after Sync = %d, want %d", seq, latest)
+	}
+}
+
+func TestIndexPurge(t *testing.T) {
+	for name, store := range map[string]data.DataStore{
+		"memory": newTestStore(),
+		"fs":     data.NewFSDataStoreFromSubdirectory(t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			index, err := OpenIndex(store, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// purged through the index
+			a := newTestPage(t, index.Store(), "# A\n")
+			// purged without going through the index
+			b := newTestPage(t, store, "# B\n")
+			err = index.Sync()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []data.ID{a, b} {
+				err = index.Store().DeleteByID(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = index.Store().PurgeByID(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.PurgeByID(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = index.Sync()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries := index.Entries(); len(entries) != 0 {
+				t.Fatalf("entries after purging = %+v", entries)
+			}
+		})
+	}
+}
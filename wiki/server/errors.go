@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// errorResponse is the body of all error responses of the API.
+// Clients should match on Code, as Message is for humans and may change.
+type errorResponse struct {
+	Code    string
+	Message string
+}
+
+// Codes of [errorResponse].
+// These are part of the API, so existing codes must not be changed.
+const (
+	codeNotFound      = "not_found"
+	codeNoRevisions   = "no_revisions"
+	codeInvalidID     = "invalid_id"
+	codeNoSuchClass   = "no_such_class"
+	codeNotApplicable = "not_applicable"
+	codeNoSuchTrait   = "no_such_trait"
+	codeBadRequest    = "bad_request"
+	codeNoChangeLog   = "no_change_log"
+	codeTrashed       = "trashed"
+	codeExists        = "exists"
+	codeCanceled      = "canceled"
+	codeInternal      = "internal"
+)
+
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{data.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{data.ErrNoRevisions, http.StatusNotFound, codeNoRevisions},
+	{data.ErrInvalidID, http.StatusBadRequest, codeInvalidID},
+	{data.ErrNoSuchClass, http.StatusNotFound, codeNoSuchClass},
+	{data.ErrNotApplicable, http.StatusNotFound, codeNotApplicable},
+	{data.ErrNoSuchTrait, http.StatusNotFound, codeNoSuchTrait},
+	{data.ErrNoChangeLog, http.StatusNotImplemented, codeNoChangeLog},
+	{data.ErrTrashed, http.StatusConflict, codeTrashed},
+	{data.ErrExists, http.StatusConflict, codeExists},
+}
+
+// writeError writes an error response for err.
+// Errors wrapping a sentinel error of the data package get the matching status and code.
+// Other errors are logged, and only reported as an internal error, as their messages can contain e.g. file paths.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, e := errorFor(r, err)
+	writeErrorCode(w, status, e.Code, e.Message)
+}
+
+// errorFor returns the status and error response for err, as written by [writeError].
+func errorFor(r *http.Request, err error) (int, errorResponse) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.status, errorResponse{c.code, err.Error()}
+		}
+	}
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// the client is gone, so no one will read this
+		return http.StatusServiceUnavailable, errorResponse{codeCanceled, "request canceled"}
+	}
+	log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+	return http.StatusInternalServerError, errorResponse{codeInternal, "internal error"}
+}
+
+// writeErrorCode writes an error response with the given status, code and message.
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	h := w.Header()
+	// headers for the successful response (e.g. by handlers setting them before failing) don't apply
+	h.Del("Content-Length")
+	h.Del("ETag")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{code, message})
+}
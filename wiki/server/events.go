@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// eventsKeepAlive is how often a comment is sent to idle event streams, so that proxies don't close them.
+const eventsKeepAlive = 30 * time.Second
+
+// handleEvents streams changes to the data store as server-sent events.
+// Each event is named by its kind (e.g. "revision"), and has a [data.Event] as JSON as its data.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := data.Watch(r.Context(), s.dataStore)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			raw, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, raw)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		}
+		err = rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// changesResponse is the body of responses of handleChanges.
+type changesResponse struct {
+	// Seq is the sequence number of the latest change, to be passed as since for the next request.
+	Seq     uint64
+	Changes []data.Change
+}
+
+// handleChanges returns the changes to the data store after the since query parameter (0 if absent), oldest first.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		since, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeErrorCode(w, 400, codeBadRequest, "invalid since")
+			return
+		}
+	}
+	seq, err := data.Seq(s.dataStore)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	changes, err := data.Changes(s.dataStore, since)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(changes) > 0 {
+		// changes made after reading seq
+		seq = max(seq, changes[len(changes)-1].Seq)
+	}
+	seq = max(seq, since)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(changesResponse{seq, changes})
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
@@ -208,6 +208,10 @@ class Data extends HTMLElement {
       const context = document.createTextNode(" " +page.Context);
       const li = document.createElement("li");
       li.appendChild(a);
+      if (page.Deleted) {
+        li.classList.add("deleted");
+        li.appendChild(document.createTextNode(" (deleted)"));
+      }
       li.appendChild(context);
       hop1.appendChild(li);
     });
@@ -219,6 +223,10 @@ class Data extends HTMLElement {
       a.textContent = page.Title ? page.Title : page.ID;
       const li = document.createElement("li");
       li.appendChild(a);
+      if (page.Deleted) {
+        li.classList.add("deleted");
+        li.appendChild(document.createTextNode(" (deleted)"));
+      }
       hop2.appendChild(li);
     });
     document.title = data.title;
@@ -1,9 +1,3 @@
-function latestCreationTime(data) {
-  const ts = data.Revisions
-    .map((revision) => (new Date(revision.CreationTime)).getTime());
-  return Math.max(...ts);
-}
-
 class PageList extends HTMLElement {
   constructor(id) {
     super();
@@ -17,27 +11,44 @@ class PageList extends HTMLElement {
 
     const wrapper = document.createElement("div");
     wrapper.classList.add('wrapper');
-    const ul = document.createElement("ul");
-    fetch('/api/v1/pages')
+    this.ul = document.createElement("ul");
+    this.load();
+    wrapper.appendChild(this.ul);
+    shadow.appendChild(wrapper);
+
+    // reload when pages change; events come before the page list is updated, so wait a bit
+    this.events = new EventSource('/api/v1/events');
+    for (const kind of ["new", "revision", "delete"]) {
+      this.events.addEventListener(kind, () => {
+        clearTimeout(this.reloadTimeout);
+        this.reloadTimeout = setTimeout(() => this.load(), 500);
+      });
+    }
+  }
+  disconnectedCallback() {
+    this.events.close();
+    clearTimeout(this.reloadTimeout);
+  }
+  load() {
+    // revalidate, as the list may have changed within its max-age
+    fetch('/api/v1/pages', {cache: "no-cache"})
       .then((resp) => resp.json())
-      .then((pageEntries) => {
-        const pageEntries2 = pageEntries  
-          .filter((pageEntry) => pageEntry.Data.Revisions.length !== 0)
-          .filter((pageEntry) => pageEntry.Data.MIMEType === "text/markdown")
-          .sort((a, b) => latestCreationTime(b.Data) - latestCreationTime(a.Data))
-        pageEntries2
-          .forEach((pageEntry) => {
+      .then((indexEntries) => {
+        // already sorted newest first
+        const pageEntries = indexEntries
+          .filter((indexEntry) => indexEntry.Revisions !== 0)
+          .filter((indexEntry) => indexEntry.MIMEType === "text/markdown")
+        const lis = pageEntries
+          .map((pageEntry) => {
             const li = document.createElement("li");
             const a = document.createElement("a");
-            a.href = `/data/${pageEntry.Data.ID}`;
-            a.textContent = pageEntry.LatestRevisionTitle
-            a.textContent = a.textContent;
+            a.href = `/data/${pageEntry.ID}`;
+            a.textContent = pageEntry.Title
             li.appendChild(a);
-            ul.appendChild(li);
+            return li;
           });
+        this.ul.replaceChildren(...lis);
       });
-    wrapper.appendChild(ul);
-    shadow.appendChild(wrapper);
   }
 }
 
@@ -39,6 +39,10 @@ class Page extends HTMLElement {
     this.classNames = [];
     this.progressIndicator = null;
     this.latestRevisionIndicator = null;
+    // revisionId is the revision the editor content is based on.
+    this.revisionId = null;
+    this.saving = false;
+    this.savePending = false;
   }
   progressSetIndeterminate() {
     this.progressIndicator.style.visibility = "visible";
@@ -57,6 +61,7 @@ class Page extends HTMLElement {
     
     // Get the revision ID from the Revision-ID header
     const revisionId = resp.headers.get('Revision-ID');
+    this.revisionId = revisionId;
     
     // Emit revisionChanged event with the loaded revision ID
     this.dispatchEvent(new CustomEvent('revisionChanged', {
@@ -69,6 +74,68 @@ class Page extends HTMLElement {
       }
     }));
   }
+  // save posts the editor content as a new revision.
+  // Only one save is in flight at a time, so that each save is based on the revision created by the previous one.
+  async save() {
+    if (this.saving) {
+      this.savePending = true;
+      return;
+    }
+    this.saving = true;
+    let done = false;
+    setTimeout(() => {
+      if (!done) this.progressSetIndeterminate();
+    }, 100);
+    try {
+      const newSource = this.editor.getEditorContent();
+      const headers = {};
+      if (this.revisionId) {
+        headers['Base-Revision-ID'] = this.revisionId;
+      }
+      const resp = await fetch(`/api/v1/page/${this.id}`, { method: "POST", body: newSource, headers });
+      if (!resp.ok && resp.status !== 409) {
+        throw new Error(`resp not ok: ${resp.status}`);
+      }
+
+      const mergeStatus = resp.headers.get('Merge-Status');
+      if (mergeStatus && this.savePending) {
+        // Showing the merged source would overwrite the edits typed while saving.
+        // Instead, the pending save posts them with the same base revision, so the server merges them with the merged revision again.
+        return;
+      }
+
+      // Get the revision ID from the Revision-ID header
+      const revisionId = resp.headers.get('Revision-ID');
+      this.revisionId = revisionId;
+
+      // The server merged our edit with someone else's (possibly with conflict markers), so show the merged source.
+      if (mergeStatus) {
+        this.editor.setValue(await resp.text());
+        if (mergeStatus === 'conflict') {
+          alert('This page was edited elsewhere at the same time, and some changes conflict. Please resolve the conflict markers.');
+        }
+      }
+
+      // Emit revisionChanged event with the new revision ID
+      this.dispatchEvent(new CustomEvent('revisionChanged', {
+        bubbles: true,
+        composed: true, // This allows the event to cross shadow DOM boundaries
+        detail: {
+          id: this.id,
+          revisionId: revisionId,
+          timestamp: new Date()
+        }
+      }));
+    } finally {
+      done = true;
+      this.progressSetDone();
+      this.saving = false;
+      if (this.savePending) {
+        this.savePending = false;
+        this.save();
+      }
+    }
+  }
   connectedCallback() {
     this.loadSource();
     const shadow = this.attachShadow({mode: "open"});
@@ -99,33 +166,7 @@ class Page extends HTMLElement {
       document.title = title || 'no title';
     });
     
-    this.editor.editor.addEventListener('input', async (event) => {
-      let done = false;
-      setTimeout(() => {
-        if (!done) this.progressSetIndeterminate();
-      }, 100);
-      const newSource = this.editor.getEditorContent();
-      const resp = await fetch(`/api/v1/page/${this.id}`, { method: "POST", body: newSource });
-      done = true;
-      this.progressSetDone();
-      if (!resp.ok) {
-        throw new Error(`resp not ok: ${resp.status}`);
-      }
-      
-      // Get the revision ID from the Revision-ID header
-      const revisionId = resp.headers.get('Revision-ID');
-      
-      // Emit revisionChanged event with the new revision ID
-      this.dispatchEvent(new CustomEvent('revisionChanged', {
-        bubbles: true,
-        composed: true, // This allows the event to cross shadow DOM boundaries
-        detail: {
-          id: this.id,
-          revisionId: revisionId,
-          timestamp: new Date()
-        }
-      }));
-    });
+    this.editor.editor.addEventListener('input', () => this.save());
     this.progressIndicator = document.createElement("progress");
     this.progressIndicator.max = 100;
     this.progressSetDone();
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"inaba.kiyuri.ca/2025/convind/query"
+	"inaba.kiyuri.ca/2025/convind/wiki"
+)
+
+// handleQuery streams the index entries of data matching the q query parameter (see [query.Parse]), newest first.
+// Entries are written as JSON, one per line, as they are found.
+// An error after the first entry is written as a last line with the fields of an error response (Code and Message).
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q, err := query.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		writeErrorCode(w, 400, codeBadRequest, fmt.Sprint(err))
+		return
+	}
+	err = s.index.Sync()
+	if err != nil {
+		// the index is still usable, only possibly stale
+		log.Printf("index: sync: %s", err)
+	}
+	src := query.Source{Store: s.dataStore, Index: s.index, Classes: s.getClasses()}
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	started := false
+	err = q.Run(r.Context(), src, func(entry wiki.IndexEntry) error {
+		if !started {
+			startQueryResponse(w)
+			started = true
+		}
+		err := enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+		// results can be slow to find (e.g. when instances are run), so send each as soon as it is found
+		return rc.Flush()
+	})
+	if err != nil && started {
+		// after the first result, the status can't be changed anymore, so the stream ends with the error as a last line
+		_, e := errorFor(r, err)
+		enc.Encode(e)
+		return
+	} else if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !started {
+		startQueryResponse(w)
+	}
+}
+
+func startQueryResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// defaultSearchLimit is the number of hits returned when the limit query parameter is not given.
+const defaultSearchLimit = 50
+
+// handleSearch returns the data matching the words in the q query parameter, best match first (see [search.Index.Search]).
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.searchIndex == nil {
+		writeErrorCode(w, 404, codeNotFound, "search is not enabled on this server")
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeErrorCode(w, 400, codeBadRequest, "q is required")
+		return
+	}
+	limit, ok := searchLimit(w, r)
+	if !ok {
+		return
+	}
+	hits := s.searchIndex.Search(q, limit)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err := json.NewEncoder(w).Encode(hits)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
 	"net/http"
 	"path/filepath"
 	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/safehtml/template"
 	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/embedding"
+	"inaba.kiyuri.ca/2025/convind/search"
 	"inaba.kiyuri.ca/2025/convind/wiki"
 )
 
@@ -23,27 +27,84 @@ var javascriptFS embed.FS
 type Server struct {
 	mux       *http.ServeMux
 	dataStore data.DataStore
+	index     *wiki.Index
 	wikiClass *wiki.WikiClass
-	classes   []data.Class
-	tps       map[string]*template.Template
+	// classes is replaced (not modified) when classes are added or replaced, so it can be used after releasing classesLock.
+	classes     []data.Class
+	classesLock sync.RWMutex
+	// searchIndex is nil if search is not enabled.
+	searchIndex *search.Index
+	// embeddingIndex is nil if embeddings are not enabled.
+	embeddingIndex *embedding.Index
+	tps            map[string]*template.Template
+
+	// startTime distinguishes index generations of different server processes in ETags, for stores without a change log.
+	startTime time.Time
+
+	// pageEditLock serializes page edits, so that concurrent edits are merged instead of racing for the latest revision.
+	pageEditLock sync.Mutex
 }
 
+// New returns a server for dataStore, with an in-memory index built by reading the whole store.
 func New(dataStore data.DataStore) (*Server, error) {
-	s := new(Server)
-	s.dataStore = dataStore
-	s.wikiClass = wiki.NewWikiClass(s.dataStore)
-	err := s.wikiClass.Load()
+	index, err := wiki.OpenIndex(dataStore, "")
 	if err != nil {
 		return nil, err
 	}
+	return NewWithIndex(index), nil
+}
+
+// NewWithIndex returns a server for the store of index.
+// All writes go through the index, so it stays up to date.
+func NewWithIndex(index *wiki.Index) *Server {
+	s := new(Server)
+	s.index = index
+	s.startTime = time.Now()
+	s.dataStore = index.Store()
+	s.wikiClass = wiki.NewWikiClass(index)
 	s.classes = append(s.classes, s.wikiClass)
 	s.parseTemplates()
 	s.setupRoutes()
-	return s, nil
+	return s
 }
 
 func (s *Server) AddClass(class data.Class) {
-	s.classes = append(s.classes, class)
+	s.ReplaceClasses(nil, []data.Class{class})
+}
+
+// ReplaceClasses removes the classes in remove, and adds the classes in add, at once (e.g. on reloading a configuration).
+// Requests already using a removed class are not affected.
+func (s *Server) ReplaceClasses(remove, add []data.Class) {
+	s.classesLock.Lock()
+	defer s.classesLock.Unlock()
+	classes := make([]data.Class, 0, len(s.classes)+len(add))
+	for _, class := range s.classes {
+		if !slices.Contains(remove, class) {
+			classes = append(classes, class)
+		}
+	}
+	s.classes = append(classes, add...)
+}
+
+// getClasses returns the current classes, which must not be modified.
+func (s *Server) getClasses() []data.Class {
+	s.classesLock.RLock()
+	defer s.classesLock.RUnlock()
+	return s.classes
+}
+
+// SetSearchIndex enables GET /api/v1/search, answered from index.
+// The caller keeps index up to date (see [search.Index.Follow]).
+func (s *Server) SetSearchIndex(index *search.Index) {
+	s.searchIndex = index
+}
+
+// SetEmbeddingIndex enables GET /api/v1/data/{id}/similar and GET /api/v1/search/semantic, answered from index.
+// The class of index is also added (see [Server.AddClass]), so embeddings can be read as instances.
+// The caller keeps index up to date (see [embedding.Index.Follow]).
+func (s *Server) SetEmbeddingIndex(index *embedding.Index) {
+	s.embeddingIndex = index
+	s.AddClass(index.Class())
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -68,11 +129,32 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("POST /api/v1/page/{id}", s.handlePage)
 	s.mux.HandleFunc("POST /api/v1/page/new", s.handlePageNew)
 	s.mux.HandleFunc("GET /api/v1/pages", s.handlePageList)
+	s.mux.HandleFunc("GET /api/v1/query", s.handleQuery)
+	s.mux.HandleFunc("GET /api/v1/search", s.handleSearch)
+	s.mux.HandleFunc("GET /api/v1/search/semantic", s.handleSemanticSearch)
 	s.mux.HandleFunc("POST /api/v1/data/new", s.handleDataNew)
 	s.mux.HandleFunc("GET /api/v1/data/{id}", s.handleData)
+	s.mux.HandleFunc("POST /api/v1/data/{id}", s.handleDataNewRevision)
 	s.mux.HandleFunc("DELETE /api/v1/data/{id}", s.handleDeleteData)
 	s.mux.HandleFunc("GET /api/v1/data/{id}/instances", s.handleDataInstances)
+	s.mux.HandleFunc("GET /api/v1/data/{id}/similar", s.handleSimilar)
 	s.mux.HandleFunc("GET /api/v1/data/{id}/instance/{className}", s.handleDataInstance)
+	s.mux.HandleFunc("GET /api/v1/data/{id}/revision/{revisionID}", s.handleRevision)
+	s.mux.HandleFunc("PUT /api/v1/data/{id}/revision/{revisionID}", s.handleImportRevision)
+	s.mux.HandleFunc("GET /api/v1/data/{id}/revision/{revisionID}/traits", s.handleTraits)
+	s.mux.HandleFunc("GET /api/v1/data/{id}/revision/{revisionID}/trait/{name...}", s.handleTrait)
+	s.mux.HandleFunc("PUT /api/v1/data/{id}/revision/{revisionID}/trait/{name...}", s.handlePutTrait)
+	s.mux.HandleFunc("GET /api/v1/sync/revisions", s.handleSyncRevisions)
+	s.mux.HandleFunc("GET /api/v1/sync/traits", s.handleSyncTraits)
+	s.mux.HandleFunc("POST /api/v1/index/rebuild", s.handleRebuildIndex)
+	s.mux.HandleFunc("GET /api/v1/events", s.handleEvents)
+	s.mux.HandleFunc("GET /api/v1/changes", s.handleChanges)
+	s.mux.HandleFunc("GET /api/v1/trash", s.handleTrash)
+	s.mux.HandleFunc("POST /api/v1/trash/{id}/restore", s.handleRestoreTrash)
+	s.mux.HandleFunc("DELETE /api/v1/trash/{id}", s.handlePurgeTrash)
+	s.mux.HandleFunc("GET /api/", func(w http.ResponseWriter, r *http.Request) {
+		writeErrorCode(w, 404, codeNotFound, "no such endpoint")
+	})
 
 	s.mux.HandleFunc("GET /", s.handleSPA)
 }
@@ -82,26 +164,24 @@ func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
 	id := new(data.ID)
 	err := id.UnmarshalText([]byte(idRaw))
 	if err != nil {
-		http.Error(w, "invalid id", 404)
+		writeError(w, r, err)
 		return
 	}
-	data, err := s.dataStore.GetDataByID(*id)
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, *id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
-	if data.MIMEType() != "text/markdown" {
-		if err != nil {
-			http.Error(w, "MIME type is not text/markdown", 404)
-			return
-		}
+	if d.MIMEType() != "text/markdown" {
+		writeErrorCode(w, 404, codeNotFound, "MIME type is not text/markdown")
+		return
 	}
-	page := wiki.Page{data}
+	page := wiki.Page{Data: d}
 	switch r.Method {
 	case "GET":
-		pr, err := page.LatestRevision()
+		pr, err := page.LatestRevisionContext(r.Context())
 		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
+			writeError(w, r, err)
 			return
 		}
 		if pr == nil {
@@ -121,81 +201,103 @@ func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		rc, err := pr.DataRevision.NewReadCloser()
+		rc, err := data.NewReadCloserContext(r.Context(), pr.DataRevision)
 		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
+			writeError(w, r, err)
 			return
 		}
 		defer rc.Close()
 		_, err = io.Copy(w, rc)
 		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
+			writeError(w, r, err)
 			// probably, the 200 header has already been written, but whatever
 			return
 		}
 	case "POST":
-		dr, err := data.NewRevision(r.Body)
+		// The Base-Revision-ID header has the ID of the revision the editor started from.
+		// Without it, the edit is assumed to be based on the latest revision.
+		var base *wiki.PageRevision
+		if baseRaw := r.Header.Get("Base-Revision-ID"); baseRaw != "" {
+			baseID, err := strconv.ParseUint(baseRaw, 10, 64)
+			if err != nil {
+				writeErrorCode(w, 400, codeBadRequest, "invalid Base-Revision-ID")
+				return
+			}
+			dr, err := data.FindRevisionContext(r.Context(), d, baseID)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if dr == nil {
+				writeErrorCode(w, 400, codeBadRequest, "base revision not found")
+				return
+			}
+			base = &wiki.PageRevision{DataRevision: dr}
+		}
+		source, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
+			writeErrorCode(w, 400, codeBadRequest, fmt.Sprint(err))
 			return
 		}
-		w.Header().Set("Revision-ID", strconv.FormatUint(dr.RevisionID(), 10))
+		s.pageEditLock.Lock()
+		// The From header is the standard header for the email address of the user making the request.
+		result, err := page.Edit(source, base, r.Header.Get("From"))
+		s.pageEditLock.Unlock()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Revision-ID", strconv.FormatUint(result.Revision.DataRevision.RevisionID(), 10))
 		// No caching for POST responses
 		w.Header().Set("Cache-Control", "no-store")
-		http.Error(w, "", 204)
+		if !result.Merged {
+			http.Error(w, "", 204)
+			return
+		}
+		// The edit was merged with someone else's, so the editor needs the merged source.
+		merged, err := result.Revision.Source()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown")
+		if result.Conflicts > 0 {
+			w.Header().Set("Merge-Status", "conflict")
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.Header().Set("Merge-Status", "merged")
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(merged)
 	}
 }
 
 func (s *Server) handlePageNew(w http.ResponseWriter, r *http.Request) {
 	data, err := s.dataStore.New("text/markdown")
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	http.Redirect(w, r, filepath.Join("/api/v1/page/", data.ID().String()), 302)
 }
 
-type pageEntry struct {
-	Data                data.Data
-	LatestRevisionTitle string
-}
-
-func (s *Server) handlePageList(w http.ResponseWriter, r *http.Request) {
-	ids, err := s.dataStore.AllIDs()
+// indexTag returns a string that changes whenever the index changes, for ETags of responses that depend on more than one data.
+// For stores with a change log, the index is synced first, and the tag is the sequence number of the latest change, so it survives restarts.
+func (s *Server) indexTag() string {
+	err := s.index.Sync()
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
-		return
+		// the index is still usable, only possibly stale
+		log.Printf("index: sync: %s", err)
 	}
-	entries := make([]pageEntry, len(ids))
-
-	// For ETag generation, we'll use a combined string of all revision IDs
-	var etagParts []string
-
-	for i, id := range ids {
-		d, err := s.dataStore.GetDataByID(id)
-		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
-			return
-		}
-		title, err := (&wiki.Page{d}).LatestRevisionTitle()
-		if err != nil {
-			http.Error(w, fmt.Sprint(err), 500)
-			return
-		}
-		entries[i] = pageEntry{Data: d, LatestRevisionTitle: title}
-
-		// Add to ETag data
-		rev, err := LatestRevision(d)
-		if err == nil && rev != nil {
-			etagParts = append(etagParts, strconv.FormatUint(rev.RevisionID(), 10))
-		}
+	if seq, ok := s.index.Seq(); ok {
+		return fmt.Sprintf("s%d", seq)
 	}
+	return fmt.Sprintf("%d-%d", s.startTime.UnixNano(), s.index.Generation())
+}
 
-	// Generate ETag from all revision IDs
-	etag := fmt.Sprintf("\"%s\"", strconv.FormatUint(uint64(len(ids)), 10))
-	if len(etagParts) > 0 {
-		etag = fmt.Sprintf("\"%s\"", strconv.Itoa(len(etagParts)))
-	}
+// handlePageList returns the index entries of all data (not only pages), newest first.
+func (s *Server) handlePageList(w http.ResponseWriter, r *http.Request) {
+	etag := fmt.Sprintf("\"%s\"", s.indexTag())
 	w.Header().Set("ETag", etag)
 
 	// Check If-None-Match header
@@ -208,14 +310,24 @@ func (s *Server) handlePageList(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "public, must-revalidate, max-age=30") // Cache for 30 seconds, then revalidate
 	w.Header().Set("Content-Type", "application/json")
 
-	err = json.NewEncoder(w).Encode(entries)
+	entries := slices.DeleteFunc(s.index.Entries(), func(entry wiki.IndexEntry) bool { return entry.Deleted })
+	err := json.NewEncoder(w).Encode(entries)
 	if err != nil {
 		// probably, the 200 header has already been written, but whatever
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 }
 
+func (s *Server) handleRebuildIndex(w http.ResponseWriter, r *http.Request) {
+	err := s.index.RebuildContext(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) handleSPA(w http.ResponseWriter, r *http.Request) {
 	// Set cache headers for SPA - allow client cache but revalidate frequently
 	// We use a short cache time because the SPA itself might change
@@ -228,12 +340,50 @@ func (s *Server) handleDataNew(w http.ResponseWriter, r *http.Request) {
 	mimeType := r.Header.Get("Content-Type")
 	d, err := s.dataStore.New(mimeType)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
+		return
+	}
+	dr, err := data.NewRevisionContext(r.Context(), d, r.Body, data.RevisionOptions{Author: r.Header.Get("From")})
+	if err != nil {
+		// e.g. the upload was interrupted; don't leave empty data behind
+		s.dataStore.DeleteByID(d.ID())
+		s.dataStore.PurgeByID(d.ID())
+		writeError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, filepath.Join("/api/v1/data", d.ID().String())+"?revision-id="+strconv.FormatUint(dr.RevisionID(), 10), 302)
+}
+
+// handleDataNewRevision creates a revision of existing data with the request body as its contents.
+// The Content-Type header sets the MIME type of the revision (and so of the data), and keeps the MIME type of the data if absent.
+func (s *Server) handleDataNewRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := data.ParseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	dr, err := d.NewRevision(r.Body)
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
+		return
+	}
+	// the new revision replaces the latest one
+	latest, err := data.LatestRevisionContext(r.Context(), d)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var parents []uint64
+	if latest != nil {
+		parents = []uint64{latest.RevisionID()}
+	}
+	dr, err := data.NewRevisionContext(r.Context(), d, r.Body, data.RevisionOptions{
+		Parents:  parents,
+		Author:   r.Header.Get("From"),
+		MIMEType: r.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 	http.Redirect(w, r, filepath.Join("/api/v1/data", d.ID().String())+"?revision-id="+strconv.FormatUint(dr.RevisionID(), 10), 302)
@@ -244,20 +394,25 @@ func (s *Server) handleData(w http.ResponseWriter, r *http.Request) {
 	id := new(data.ID)
 	err := id.UnmarshalText([]byte(idRaw))
 	if err != nil {
-		http.Error(w, "invalid id", 404)
+		writeError(w, r, err)
 		return
 	}
-	data, err := s.dataStore.GetDataByID(*id)
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, *id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
-	dr, err := LatestRevision(data)
+	// revisions can have different MIME types, so older revisions (e.g. redirected to after uploading) are served as such
+	dr, err := getDataRevision(r, d)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", data.MIMEType())
+	if dr != nil {
+		w.Header().Set("Content-Type", dr.MIMEType())
+	} else {
+		w.Header().Set("Content-Type", d.MIMEType())
+	}
 
 	// Add ETag based on revision ID if one exists
 	if dr != nil {
@@ -278,15 +433,15 @@ func (s *Server) handleData(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(204)
 		return
 	}
-	rc, err := dr.NewReadCloser()
+	rc, err := data.NewReadCloserContext(r.Context(), dr)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	defer rc.Close()
 	_, err = io.Copy(w, rc)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		// probably, the 200 header has already been written, but whatever
 		return
 	}
@@ -312,25 +467,26 @@ func (s *Server) handleDataInstances(w http.ResponseWriter, r *http.Request) {
 	id := new(data.ID)
 	err := id.UnmarshalText([]byte(idRaw))
 	if err != nil {
-		http.Error(w, "invalid id", 404)
+		writeError(w, r, err)
 		return
 	}
-	data, err := s.dataStore.GetDataByID(*id)
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, *id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
-	dr, err := getDataRevision(r, data)
+	dr, err := getDataRevision(r, d)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	// Add ETag based on revision ID if one exists
+	// Add ETag based on revision ID (and the latest change to the data, which may change its MIME type) if one exists
 	if dr != nil {
-		etag := fmt.Sprintf("\"%d\"", dr.RevisionID())
+		entry, _ := s.index.Entry(d.ID())
+		etag := fmt.Sprintf("\"%d-s%d\"", dr.RevisionID(), entry.Seq)
 		w.Header().Set("ETag", etag)
 
 		// Check If-None-Match header
@@ -348,15 +504,15 @@ func (s *Server) handleDataInstances(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	availableClassNames := make([]string, 0)
-	for _, class := range s.classes {
-		_, err := class.AttemptInstance(dr)
+	for _, class := range s.getClasses() {
+		_, err := data.AttemptInstanceContext(r.Context(), class, dr)
 		if err == nil {
 			availableClassNames = append(availableClassNames, class.Name())
 		}
 	}
 	err = json.NewEncoder(w).Encode(availableClassNames)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		// probably, the 200 header has already been written, but whatever
 		return
 	}
@@ -372,26 +528,30 @@ func (s *Server) handleDataInstance(w http.ResponseWriter, r *http.Request) {
 	id := new(data.ID)
 	err := id.UnmarshalText([]byte(idRaw))
 	if err != nil {
-		http.Error(w, "invalid id", 404)
+		writeError(w, r, err)
 		return
 	}
-	data, err := s.dataStore.GetDataByID(*id)
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, *id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
-	dr, err := getDataRevision(r, data)
+	dr, err := getDataRevision(r, d)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	if dr == nil {
-		http.Error(w, "", 204)
+		writeError(w, r, fmt.Errorf("data %s: %w", d.ID(), data.ErrNoRevisions))
 		return
 	}
 
 	// Add ETag based on revision ID
 	etag := fmt.Sprintf("\"%s-%d\"", className, dr.RevisionID())
+	if className == s.wikiClass.Name() {
+		// links from other data are part of the instance
+		etag = fmt.Sprintf("\"%s-%d-%s\"", className, dr.RevisionID(), s.indexTag())
+	}
 	w.Header().Set("ETag", etag)
 
 	// Check If-None-Match header
@@ -403,27 +563,28 @@ func (s *Server) handleDataInstance(w http.ResponseWriter, r *http.Request) {
 	// Set cache control - allow client cache but revalidate
 	w.Header().Set("Cache-Control", "public, must-revalidate, max-age=60") // Cache for a minute, then revalidate
 
-	classIndex := slices.IndexFunc(s.classes, classWithName(className))
+	classes := s.getClasses()
+	classIndex := slices.IndexFunc(classes, classWithName(className))
 	if classIndex == -1 {
-		http.Error(w, "no such class", 404)
+		writeError(w, r, fmt.Errorf("%w: %s", data.ErrNoSuchClass, className))
 		return
 	}
-	class := s.classes[classIndex]
-	instance, err := class.AttemptInstance(dr)
+	class := classes[classIndex]
+	instance, err := data.AttemptInstanceContext(r.Context(), class, dr)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", instance.MIMEType())
-	rc, err := instance.NewReadCloser()
+	rc, err := data.NewInstanceReadCloserContext(r.Context(), instance)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	defer rc.Close()
 	_, err = io.Copy(w, rc)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		// probably, the 200 header has already been written, but whatever
 		return
 	}
@@ -434,12 +595,12 @@ func (s *Server) handleDeleteData(w http.ResponseWriter, r *http.Request) {
 	id := new(data.ID)
 	err := id.UnmarshalText([]byte(idRaw))
 	if err != nil {
-		http.Error(w, "invalid id", 404)
+		writeError(w, r, err)
 		return
 	}
 	err = s.dataStore.DeleteByID(*id)
 	if err != nil {
-		http.Error(w, fmt.Sprint(err), 500)
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -460,7 +621,7 @@ func getDataRevision(r *http.Request, d data.Data) (data.DataRevision, error) {
 	if err != nil {
 		goto LatestRevision
 	}
-	revisions, err = d.Revisions()
+	revisions, err = data.RevisionsContext(r.Context(), d)
 	if err != nil {
 		return nil, err
 	}
@@ -471,5 +632,5 @@ func getDataRevision(r *http.Request, d data.Data) (data.DataRevision, error) {
 	}
 	// revision ID not found, so fall back to latest
 LatestRevision:
-	return LatestRevision(d)
+	return data.LatestRevisionContext(r.Context(), d)
 }
@@ -0,0 +1,511 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/embedding"
+	"inaba.kiyuri.ca/2025/convind/search"
+)
+
+// newTestServer returns a server backed by a MemoryDataStore with a deterministic clock and IDs, and the given pages.
+func newTestServer(t *testing.T, pages ...string) (*Server, *data.MemoryDataStore, []data.ID) {
+	store := data.NewMemoryDataStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	var n uint64
+	store.NewID = func() data.ID {
+		n++
+		return data.ID{Epoch: 1, Random: n}
+	}
+	store.NewRevisionID = func() uint64 {
+		n++
+		return n
+	}
+	ids := make([]data.ID, len(pages))
+	for i, source := range pages {
+		d, err := store.New("text/markdown")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = d.NewRevision(strings.NewReader(source), data.RevisionOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = d.ID()
+	}
+	s, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, store, ids
+}
+
+func get(t *testing.T, s *Server, path string, v any) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Code != 200 {
+		t.Fatalf("GET %s: status %d: %s", path, rr.Code, rr.Body)
+	}
+	if v != nil {
+		err := json.Unmarshal(rr.Body.Bytes(), v)
+		if err != nil {
+			t.Fatalf("GET %s: %s", path, err)
+		}
+	}
+	return rr
+}
+
+func TestPageList(t *testing.T) {
+	cases := []struct {
+		name   string
+		pages  []string
+		titles []string
+	}{
+		{"empty", nil, []string{}},
+		{"one", []string{"# A\n"}, []string{"A"}},
+		{"no heading", []string{"plain\n", "# B\n"}, []string{"B", "plain"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, _, _ := newTestServer(t, c.pages...)
+			var entries []struct {
+				ID       data.ID
+				MIMEType string
+				Title    string
+			}
+			get(t, s, "/api/v1/pages", &entries)
+			titles := make([]string, len(entries))
+			for i, entry := range entries {
+				titles[i] = entry.Title
+				if entry.MIMEType != "text/markdown" {
+					t.Errorf("MIMEType = %q", entry.MIMEType)
+				}
+			}
+			slices.Sort(titles)
+			if !slices.Equal(titles, c.titles) {
+				t.Errorf("titles = %v, want %v", titles, c.titles)
+			}
+		})
+	}
+}
+
+func TestPageListETag(t *testing.T) {
+	s, _, ids := newTestServer(t, "# A\n")
+	etag := get(t, s, "/api/v1/pages", nil).Header().Get("ETag")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/pages", nil)
+	req.Header.Set("If-None-Match", etag)
+	s.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("unchanged: status %d", rr.Code)
+	}
+
+	// editing doesn't change the number of pages, only the title
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/page/"+ids[0].String(), strings.NewReader("# A2\n")))
+	if rr.Code/100 != 2 {
+		t.Fatalf("edit: status %d: %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/pages", nil)
+	req.Header.Set("If-None-Match", etag)
+	s.ServeHTTP(rr, req)
+	if rr.Code != 200 || !strings.Contains(rr.Body.String(), `"Title":"A2"`) {
+		t.Fatalf("after edit: status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	s, store, ids := newTestServer(t, "# A\n")
+	var all changesResponse
+	get(t, s, "/api/v1/changes", &all)
+	if len(all.Changes) != 2 || all.Changes[0].Kind != data.EventNew || all.Changes[1].Kind != data.EventRevision || all.Seq != all.Changes[1].Seq {
+		t.Fatalf("changes = %+v", all)
+	}
+
+	err := store.DeleteByID(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var since changesResponse
+	get(t, s, "/api/v1/changes?since="+strconv.FormatUint(all.Seq, 10), &since)
+	if len(since.Changes) != 1 || since.Changes[0].Kind != data.EventDelete || since.Seq <= all.Seq {
+		t.Fatalf("changes since %d = %+v", all.Seq, since)
+	}
+	var none changesResponse
+	get(t, s, "/api/v1/changes?since="+strconv.FormatUint(since.Seq, 10), &none)
+	if len(none.Changes) != 0 || none.Seq != since.Seq {
+		t.Fatalf("changes since %d = %+v", since.Seq, none)
+	}
+}
+
+func TestDataNewRevision(t *testing.T) {
+	s, store, ids := newTestServer(t, "# A\n")
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/data/"+ids[0].String(), strings.NewReader("plain"))
+	req.Header.Set("Content-Type", "text/plain")
+	s.ServeHTTP(rr, req)
+	if rr.Code != 302 {
+		t.Fatalf("POST: status %d: %s", rr.Code, rr.Body)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = get(t, s, "/api/v1/data/"+ids[0].String(), nil)
+	if got := rr.Header().Get("Content-Type"); got != "text/plain" || rr.Body.String() != "plain" {
+		t.Fatalf("latest revision: %s: %q", got, rr.Body)
+	}
+	rr = get(t, s, location.String(), nil)
+	if got := rr.Header().Get("Content-Type"); got != "text/plain" {
+		t.Fatalf("new revision: %s", got)
+	}
+	var d struct {
+		MIMEType  string
+		Revisions []struct {
+			RevisionID uint64
+			MIMEType   string
+		}
+	}
+	stored, err := store.GetDataByID(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(raw, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MIMEType != "text/plain" || len(d.Revisions) != 2 || d.Revisions[0].MIMEType != "text/plain" || d.Revisions[1].MIMEType != "text/markdown" {
+		t.Fatalf("data = %+v", d)
+	}
+	rr = get(t, s, "/api/v1/data/"+ids[0].String()+"?revision-id="+strconv.FormatUint(d.Revisions[1].RevisionID, 10), nil)
+	if got := rr.Header().Get("Content-Type"); got != "text/markdown" {
+		t.Fatalf("older revision: %s", got)
+	}
+
+	// no longer a page
+	var entries []struct{ MIMEType string }
+	get(t, s, "/api/v1/pages", &entries)
+	if len(entries) != 1 || entries[0].MIMEType != "text/plain" {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s, _, ids := newTestServer(t, "# Alpha\n", "# Beta\n\n[Alpha](convind://"+data.ID{Epoch: 1, Random: 1}.String()+")\n")
+	rr := get(t, s, "/api/v1/query?q="+url.QueryEscape("links-to:"+ids[0].String()), nil)
+	if got := rr.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %s", got)
+	}
+	dec := json.NewDecoder(rr.Body)
+	var got []data.ID
+	for dec.More() {
+		var entry struct{ ID data.ID }
+		err := dec.Decode(&entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, entry.ID)
+	}
+	if !slices.Equal(got, ids[1:]) {
+		t.Fatalf("results = %v, want %v", got, ids[1:])
+	}
+
+	rr = get(t, s, "/api/v1/query?q=title:gamma", nil)
+	if rr.Body.Len() != 0 {
+		t.Fatalf("results for no match = %q", rr.Body)
+	}
+
+	for q, code := range map[string]string{"unknown:x": codeBadRequest, "instance:nonexistent": codeNoSuchClass} {
+		rr = httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/query?q="+url.QueryEscape(q), nil))
+		var resp errorResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		if err != nil || resp.Code != code {
+			t.Errorf("%s: status %d: %s", q, rr.Code, rr.Body)
+		}
+	}
+}
+
+// cancelClass applies to all revisions, and calls cancel when attempting the second one.
+type cancelClass struct {
+	cancel   context.CancelFunc
+	attempts *int
+}
+
+func (c cancelClass) Name() string { return "example.com/cancel" }
+
+func (c cancelClass) AttemptInstance(dr data.DataRevision) (data.Instance, error) {
+	*c.attempts++
+	if *c.attempts == 2 {
+		c.cancel()
+	}
+	return revisionInstance{dr}, nil
+}
+
+type revisionInstance struct{ dr data.DataRevision }
+
+func (i revisionInstance) DataRevision() data.DataRevision       { return i.dr }
+func (i revisionInstance) MIMEType() string                      { return i.dr.MIMEType() }
+func (i revisionInstance) NewReadCloser() (io.ReadCloser, error) { return i.dr.NewReadCloser() }
+
+func TestQueryErrorAfterResults(t *testing.T) {
+	s, _, ids := newTestServer(t, "# Alpha\n", "# Beta\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.ReplaceClasses(nil, []data.Class{cancelClass{cancel, new(int)}})
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/query?q=instance:cancel", nil).WithContext(ctx))
+	if rr.Code != 200 || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d, Content-Type %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("body = %q", rr.Body)
+	}
+	var entry struct{ ID data.ID }
+	err := json.Unmarshal([]byte(lines[0]), &entry)
+	if err != nil || entry.ID != ids[1] {
+		t.Fatalf("first line = %s", lines[0])
+	}
+	var resp errorResponse
+	err = json.Unmarshal([]byte(lines[1]), &resp)
+	if err != nil || resp.Code != codeCanceled {
+		t.Fatalf("last line = %s", lines[1])
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s, store, ids := newTestServer(t, "# Alpha\n\nabout cats\n", "# Beta\n\nabout dogs\n")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/search?q=cats", nil))
+	if rr.Code != 404 {
+		t.Fatalf("search without an index: status %d", rr.Code)
+	}
+
+	x, err := search.Open(store, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSearchIndex(x)
+	var hits []search.Hit
+	get(t, s, "/api/v1/search?q=cats", &hits)
+	if len(hits) != 1 || hits[0].ID != ids[0] || hits[0].Title != "Alpha" || hits[0].Snippet != "Alpha about cats" {
+		t.Fatalf("hits = %+v", hits)
+	}
+	get(t, s, "/api/v1/search?q=about&limit=1", &hits)
+	if len(hits) != 1 {
+		t.Fatalf("hits with limit = %+v", hits)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	s, store, ids := newTestServer(t, "# Alpha\n\ncats\n", "# Beta\n\ndogs\n", "# Gamma\n\ncats\n")
+	// the embedding is whether the text has cats and dogs
+	class := embedding.NewClass("example.com/embedding", []string{"sh", "-c", "x=$(cat); echo $(echo \"$x\" | grep -c cats) $(echo \"$x\" | grep -c dogs)"}, nil)
+	x := embedding.NewIndex(store, class)
+	err := x.Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetEmbeddingIndex(x)
+	var hits []similarHit
+	get(t, s, "/api/v1/data/"+ids[0].String()+"/similar?limit=1", &hits)
+	if len(hits) != 1 || hits[0].ID != ids[2] || hits[0].Title != "Gamma" {
+		t.Fatalf("similar = %+v", hits)
+	}
+	get(t, s, "/api/v1/search/semantic?q=dogs", &hits)
+	if len(hits) != 3 || hits[0].ID != ids[1] {
+		t.Fatalf("semantic search = %+v", hits)
+	}
+
+	image, err := store.New("image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = image.NewRevision(strings.NewReader("png"), data.RevisionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/data/"+image.ID().String()+"/similar", nil))
+	var resp errorResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != 404 || err != nil || resp.Code != codeNotApplicable {
+		t.Fatalf("similar to an image: status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	s, store, ids := newTestServer(t, "# A\n\n[B](convind://"+data.ID{Epoch: 1, Random: 3}.String()+")\n", "# B\n")
+
+	var classNames []string
+	get(t, s, "/api/v1/data/"+ids[0].String()+"/instances", &classNames)
+	if !slices.Equal(classNames, []string{s.wikiClass.Name()}) {
+		t.Fatalf("instances = %v", classNames)
+	}
+
+	var hops struct {
+		Hop1 []struct {
+			ID      data.ID
+			Title   string
+			Deleted bool
+		} `json:"1"`
+		Title string `json:"title"`
+	}
+	get(t, s, "/api/v1/data/"+ids[1].String()+"/instance/"+url.PathEscape(s.wikiClass.Name()), &hops)
+	if hops.Title != "B" || len(hops.Hop1) != 1 || hops.Hop1[0].ID != ids[0] || hops.Hop1[0].Title != "A" {
+		t.Fatalf("wiki instance of B = %+v", hops)
+	}
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/data/"+ids[0].String(), nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d: %s", rr.Code, rr.Body)
+	}
+	trash, err := store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != ids[0] {
+		t.Fatalf("Trash = %v", trash)
+	}
+	get(t, s, "/api/v1/data/"+ids[1].String()+"/instance/"+url.PathEscape(s.wikiClass.Name()), &hops)
+	if len(hops.Hop1) != 0 {
+		t.Fatalf("links from trashed data are still shown: %+v", hops)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, store, ids := newTestServer(t, "# A\n")
+	empty, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// data in the trash, and again outside it with the same ID (e.g. imported by a sync before the trash was synced)
+	restored, err := store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteByID(restored.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID := store.NewID
+	store.NewID = func() data.ID { return restored.ID() }
+	_, err = store.New("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.NewID = newID
+	dir := t.TempDir()
+	fsServer, err := New(data.NewFSDataStoreFromSubdirectory(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := data.ID{Epoch: 1, Random: 1000}.String()
+	cases := []struct {
+		name   string
+		s      *Server
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"missing", s, "GET", "/api/v1/data/" + missing, 404, codeNotFound},
+		{"missing in FS store", fsServer, "GET", "/api/v1/data/" + missing, 404, codeNotFound},
+		{"invalid ID", s, "GET", "/api/v1/data/garbage", 400, codeInvalidID},
+		{"restore over existing data", s, "POST", "/api/v1/trash/" + restored.ID().String() + "/restore", 409, codeExists},
+		{"no revisions", s, "GET", "/api/v1/data/" + empty.ID().String() + "/instance/" + url.PathEscape(s.wikiClass.Name()), 404, codeNoRevisions},
+		{"no such class", s, "GET", "/api/v1/data/" + ids[0].String() + "/instance/example.com%2Fnone", 404, codeNoSuchClass},
+		{"no such revision", s, "GET", "/api/v1/data/" + ids[0].String() + "/revision/1000", 404, codeNotFound},
+		{"not in trash", s, "DELETE", "/api/v1/trash/" + ids[0].String(), 404, codeNotFound},
+		{"no such endpoint", s, "GET", "/api/v1/nothing", 404, codeNotFound},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c.s.ServeHTTP(rr, httptest.NewRequest(c.method, c.path, nil))
+			if rr.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", rr.Code, c.status, rr.Body)
+			}
+			if strings.Contains(rr.Body.String(), dir) {
+				t.Fatalf("response leaks path: %s", rr.Body)
+			}
+			var resp errorResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("%s: %s", err, rr.Body)
+			}
+			if resp.Code != c.code {
+				t.Fatalf("code = %q, want %q (%s)", resp.Code, c.code, resp.Message)
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", hs.URL+"/api/v1/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	resp2, err := http.Post(hs.URL+"/api/v1/data/new", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+
+	br := bufio.NewReader(resp.Body)
+	var kinds []string
+	for len(kinds) < 2 {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind, ok := strings.CutPrefix(strings.TrimSpace(line), "event: "); ok {
+			kinds = append(kinds, kind)
+		}
+	}
+	if !slices.Equal(kinds, []string{"new", "revision"}) {
+		t.Fatalf("events = %v", kinds)
+	}
+}
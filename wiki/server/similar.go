@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/embedding"
+)
+
+// similarHit is a result of a nearest-neighbour lookup, with the title and MIME type from the index.
+type similarHit struct {
+	ID         data.ID
+	Title      string
+	MIMEType   string
+	Similarity float64
+}
+
+// searchLimit returns the limit query parameter, or defaultSearchLimit if it is not given.
+// It writes an error response and returns false if the limit is invalid.
+func searchLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultSearchLimit, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		writeErrorCode(w, 400, codeBadRequest, "limit must be a positive integer")
+		return 0, false
+	}
+	return limit, true
+}
+
+// writeMatches writes matches with their titles and MIME types.
+func (s *Server) writeMatches(w http.ResponseWriter, r *http.Request, matches []embedding.Match) {
+	hits := make([]similarHit, len(matches))
+	for i, match := range matches {
+		entry, _ := s.index.Entry(match.ID)
+		hits[i] = similarHit{match.ID, entry.Title, entry.MIMEType, match.Similarity}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err := json.NewEncoder(w).Encode(hits)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+// handleSimilar returns the data most similar in meaning to the latest revision of the given data.
+func (s *Server) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	if s.embeddingIndex == nil {
+		writeErrorCode(w, 404, codeNotFound, "embeddings are not enabled on this server")
+		return
+	}
+	id := new(data.ID)
+	err := id.UnmarshalText([]byte(r.PathValue("id")))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	limit, ok := searchLimit(w, r)
+	if !ok {
+		return
+	}
+	matches, err := s.embeddingIndex.Similar(r.Context(), *id, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeMatches(w, r, matches)
+}
+
+// handleSemanticSearch returns the data most similar in meaning to the q query parameter.
+func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if s.embeddingIndex == nil {
+		writeErrorCode(w, 404, codeNotFound, "embeddings are not enabled on this server")
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeErrorCode(w, 400, codeBadRequest, "q is required")
+		return
+	}
+	limit, ok := searchLimit(w, r)
+	if !ok {
+		return
+	}
+	matches, err := s.embeddingIndex.Search(r.Context(), q, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeMatches(w, r, matches)
+}
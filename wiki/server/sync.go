@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/datasync"
+)
+
+func (s *Server) handleSyncRevisions(w http.ResponseWriter, r *http.Request) {
+	entries, err := datasync.EntriesContext(r.Context(), s.dataStore)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+func (s *Server) handleSyncTraits(w http.ResponseWriter, r *http.Request) {
+	entries, err := datasync.TraitEntriesContext(r.Context(), s.dataStore)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+// parseRevisionPath returns the ID and revision ID in the path of r.
+func parseRevisionPath(r *http.Request) (data.ID, uint64, error) {
+	id, err := data.ParseID(r.PathValue("id"))
+	if err != nil {
+		return data.ID{}, 0, err
+	}
+	revisionID, err := strconv.ParseUint(r.PathValue("revisionID"), 10, 64)
+	if err != nil {
+		return data.ID{}, 0, fmt.Errorf("%w: revision ID: %w", data.ErrInvalidID, err)
+	}
+	return id, revisionID, nil
+}
+
+func (s *Server) handleRevision(w http.ResponseWriter, r *http.Request) {
+	dr := s.getRevisionFromPath(w, r)
+	if dr == nil {
+		return
+	}
+	sha256Hex, err := dr.SHA256()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rc, err := data.NewReadCloserContext(r.Context(), dr)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer rc.Close()
+	datasync.SetRevisionHeaders(w.Header(), data.GetRevisionInfo(dr))
+	w.Header().Set("Content-SHA256", sha256Hex)
+	// revisions are immutable
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	_, err = io.Copy(w, rc)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+func (s *Server) handleImportRevision(w http.ResponseWriter, r *http.Request) {
+	id, revisionID, err := parseRevisionPath(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	info := data.RevisionInfo{ID: id, RevisionID: revisionID}
+	err = datasync.ParseRevisionHeaders(r.Header, &info)
+	if err != nil {
+		writeErrorCode(w, 400, codeBadRequest, fmt.Sprint(err))
+		return
+	}
+	_, err = data.ImportRevisionContext(r.Context(), s.dataStore, info, r.Body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+// getRevisionFromPath returns the revision specified by the id and revisionID path values.
+// On failure, an error response is written and nil is returned.
+func (s *Server) getRevisionFromPath(w http.ResponseWriter, r *http.Request) data.DataRevision {
+	id, revisionID, err := parseRevisionPath(r)
+	if err != nil {
+		writeError(w, r, err)
+		return nil
+	}
+	d, err := data.GetDataByIDContext(r.Context(), s.dataStore, id)
+	if err != nil {
+		writeError(w, r, err)
+		return nil
+	}
+	dr, err := data.FindRevisionContext(r.Context(), d, revisionID)
+	if err != nil {
+		writeError(w, r, err)
+		return nil
+	}
+	if dr == nil {
+		writeError(w, r, fmt.Errorf("revision %d of %s: %w", revisionID, id, data.ErrNotFound))
+		return nil
+	}
+	return dr
+}
+
+func (s *Server) handleTraits(w http.ResponseWriter, r *http.Request) {
+	dr := s.getRevisionFromPath(w, r)
+	if dr == nil {
+		return
+	}
+	names, err := dr.Traits().List()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	err = json.NewEncoder(w).Encode(names)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+func (s *Server) handleTrait(w http.ResponseWriter, r *http.Request) {
+	dr := s.getRevisionFromPath(w, r)
+	if dr == nil {
+		return
+	}
+	rc, err := dr.Traits().Get(r.PathValue("name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer rc.Close()
+	// traits can be replaced, so always revalidate
+	w.Header().Set("Cache-Control", "no-cache")
+	_, err = io.Copy(w, rc)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+func (s *Server) handlePutTrait(w http.ResponseWriter, r *http.Request) {
+	dr := s.getRevisionFromPath(w, r)
+	if dr == nil {
+		return
+	}
+	err := dr.Traits().Put(r.PathValue("name"), r.Body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"inaba.kiyuri.ca/2025/convind/data"
+)
+
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.dataStore.Trash()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		writeError(w, r, err)
+		// probably, the 200 header has already been written, but whatever
+		return
+	}
+}
+
+func (s *Server) handleRestoreTrash(w http.ResponseWriter, r *http.Request) {
+	id, err := data.ParseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = s.dataStore.RestoreByID(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePurgeTrash(w http.ResponseWriter, r *http.Request) {
+	id, err := data.ParseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = s.dataStore.PurgeByID(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,12 +3,16 @@ package wiki
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"io"
 	"strconv"
 	"strings"
 
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
 	"inaba.kiyuri.ca/2025/convind/data"
+	"inaba.kiyuri.ca/2025/convind/merge"
 )
 
 type Page struct {
@@ -35,19 +39,15 @@ func (p *Page) Revisions() ([]*PageRevision, error) {
 
 // LatestRevision returns the latest revision if available, and nil is there are no revisions at all.
 func (p *Page) LatestRevision() (*PageRevision, error) {
-	revisions, err := p.Data.Revisions()
-	if err != nil {
+	return p.LatestRevisionContext(context.Background())
+}
+
+// LatestRevisionContext is [Page.LatestRevision], but lists revisions with [data.RevisionsContext].
+func (p *Page) LatestRevisionContext(ctx context.Context) (*PageRevision, error) {
+	latestRevision, err := data.LatestRevisionContext(ctx, p.Data)
+	if err != nil || latestRevision == nil {
 		return nil, err
 	}
-	var latestRevision data.DataRevision
-	for _, revision := range revisions {
-		if latestRevision == nil || revision.CreationTime().After(latestRevision.CreationTime()) {
-			latestRevision = revision
-		}
-	}
-	if latestRevision == nil {
-		return nil, nil
-	}
 	return &PageRevision{latestRevision}, nil
 }
 
@@ -62,6 +62,61 @@ func (p *Page) LatestRevisionTitle() (string, error) {
 	return pr.Title()
 }
 
+// EditResult is the result of [Page.Edit].
+type EditResult struct {
+	// Revision is the revision created by the edit.
+	Revision *PageRevision
+	// Merged is true if the edit was based on an outdated revision, and Revision is the result of merging the edit with the latest revision.
+	Merged bool
+	// Conflicts is the number of regions in Revision surrounded by conflict markers.
+	Conflicts int
+}
+
+// Edit saves source as a new revision, which was edited starting from base.
+// If base is nil or the latest revision, source is saved as-is.
+// Otherwise, the edit is saved as a revision based on base, and then merged with the latest revision using a three-way merge.
+// Conflicting changes are kept in the merged revision, surrounded by conflict markers.
+// author is recorded as the author of all created revisions.
+func (p *Page) Edit(source []byte, base *PageRevision, author string) (EditResult, error) {
+	latest, err := p.LatestRevision()
+	if err != nil {
+		return EditResult{}, err
+	}
+	if base == nil {
+		base = latest
+	}
+	var parents []uint64
+	if base != nil {
+		parents = []uint64{base.DataRevision.RevisionID()}
+	}
+	dr, err := p.Data.NewRevision(bytes.NewReader(source), data.RevisionOptions{Parents: parents, Author: author})
+	if err != nil {
+		return EditResult{}, err
+	}
+	edited := &PageRevision{dr}
+	if latest == nil || latest.DataRevision.RevisionID() == base.DataRevision.RevisionID() {
+		return EditResult{Revision: edited}, nil
+	}
+
+	baseSource, err := base.Source()
+	if err != nil {
+		return EditResult{}, err
+	}
+	latestSource, err := latest.Source()
+	if err != nil {
+		return EditResult{}, err
+	}
+	result := merge.ThreeWay(baseSource, latestSource, source, latest.URL(), edited.URL())
+	dr, err = p.Data.NewRevision(bytes.NewReader(result.Merged), data.RevisionOptions{
+		Parents: []uint64{latest.DataRevision.RevisionID(), edited.DataRevision.RevisionID()},
+		Author:  author,
+	})
+	if err != nil {
+		return EditResult{}, err
+	}
+	return EditResult{Revision: &PageRevision{dr}, Merged: true, Conflicts: result.Conflicts}, nil
+}
+
 type PageRevision struct {
 	DataRevision data.DataRevision
 }
@@ -81,12 +136,57 @@ func (p *PageRevision) Title() (string, error) {
 	return strings.TrimPrefix(s.Text(), "# "), s.Err()
 }
 
-func (p *PageRevision) View() (string, error) {
+// Source returns the Markdown source of this revision.
+func (p *PageRevision) Source() ([]byte, error) {
 	rc, err := p.DataRevision.NewReadCloser()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Text returns the text of this revision without Markdown syntax (e.g. link destinations), with a line per block.
+func (p *PageRevision) Text() (string, error) {
+	source, err := p.Source()
 	if err != nil {
 		return "", err
 	}
-	source, err := io.ReadAll(rc)
+	return markdownText(source), nil
+}
+
+func markdownText(source []byte) string {
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+	var sb strings.Builder
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock && sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+				sb.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			sb.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(n.Value)
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := range lines.Len() {
+				line := lines.At(i)
+				sb.Write(line.Value(source))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return sb.String()
+}
+
+func (p *PageRevision) View() (string, error) {
+	source, err := p.Source()
 	if err != nil {
 		return "", err
 	}